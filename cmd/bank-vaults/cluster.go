@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/jacohend/bank-vaults/pkg/kv"
+	"github.com/jacohend/bank-vaults/pkg/vault"
+	"github.com/spf13/viper"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const defaultVaultPort = "8200"
+
+// vaultNode is a single Vault server of a (possibly HA) Vault cluster
+type vaultNode struct {
+	address string
+	client  *api.Client
+	vault   vault.Vault
+}
+
+// nodeResult holds the outcome of an operation executed on a vaultNode
+type nodeResult struct {
+	address string
+	err     error
+}
+
+// vaultNodesForConfig returns the Vault nodes to operate on, these are either listed statically,
+// discovered through Kubernetes, or the single Vault server set in VAULT_ADDR
+func vaultNodesForConfig(cfg *viper.Viper, store kv.Service) ([]vaultNode, error) {
+	vaultConfig, err := vaultConfigForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error building vault config: %s", err.Error())
+	}
+
+	addresses, err := vaultAddressesForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// no cluster configuration was given, fall back to VAULT_ADDR
+	if len(addresses) == 0 {
+		cl, err := api.NewClient(nil)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to vault: %s", err.Error())
+		}
+		addresses = []string{cl.Address()}
+	}
+
+	nodes := []vaultNode{}
+	for _, address := range addresses {
+		cl, err := vaultClientForAddress(address)
+		if err != nil {
+			return nil, fmt.Errorf("error creating vault client for %s: %s", address, err.Error())
+		}
+
+		v, err := vault.New(store, cl, vaultConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating vault helper: %s", err.Error())
+		}
+
+		nodes = append(nodes, vaultNode{address: address, client: cl, vault: v})
+	}
+
+	return nodes, nil
+}
+
+// vaultAddressesForConfig returns the addresses of the Vault nodes listed or discovered based on the configuration
+func vaultAddressesForConfig(cfg *viper.Viper) ([]string, error) {
+	if list := cfg.GetString(cfgVaultAddresses); list != "" {
+		addresses := []string{}
+		for _, address := range strings.Split(list, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+		return addresses, nil
+	}
+
+	service := cfg.GetString(cfgVaultK8SService)
+	labelSelector := cfg.GetString(cfgVaultK8SLabelSelector)
+
+	if service == "" && labelSelector == "" {
+		return nil, nil
+	}
+
+	namespace := vault.KubernetesNamespace(cfg.GetString(cfgVaultK8SNamespace))
+
+	// the scheme and the port of the discovered nodes are taken from VAULT_ADDR
+	vaultAddress, err := url.Parse(api.DefaultConfig().Address)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing vault address: %s", err.Error())
+	}
+
+	client, err := vault.KubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if service != "" {
+		return discoverVaultAddressesByService(client, namespace, service, vaultAddress)
+	}
+	return discoverVaultAddressesByLabelSelector(client, namespace, labelSelector, vaultAddress)
+}
+
+// discoverVaultAddressesByService lists the Vault nodes behind the Endpoints of a Service, sealed Vault
+// nodes are not ready (see the operator's readiness probe), so not ready addresses are listed as well
+func discoverVaultAddressesByService(client kubernetes.Interface, namespace, service string, vaultAddress *url.URL) ([]string, error) {
+	endpoints, err := client.CoreV1().Endpoints(namespace).Get(service, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting endpoints of service '%s': %s", service, err.Error())
+	}
+
+	addresses := []string{}
+	for _, subset := range endpoints.Subsets {
+		port := endpointPort(subset.Ports, vaultAddress.Port())
+		for _, address := range append(subset.Addresses, subset.NotReadyAddresses...) {
+			addresses = append(addresses, nodeAddress(vaultAddress.Scheme, address.IP, port))
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no endpoints found for service '%s'", service)
+	}
+	return addresses, nil
+}
+
+// discoverVaultAddressesByLabelSelector lists the Vault nodes running in Pods matching the label selector
+func discoverVaultAddressesByLabelSelector(client kubernetes.Interface, namespace, labelSelector string, vaultAddress *url.URL) ([]string, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods with selector '%s': %s", labelSelector, err.Error())
+	}
+
+	port := vaultAddress.Port()
+	if port == "" {
+		port = defaultVaultPort
+	}
+
+	addresses := []string{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		addresses = append(addresses, nodeAddress(vaultAddress.Scheme, pod.Status.PodIP, port))
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no running pods found with selector '%s'", labelSelector)
+	}
+	return addresses, nil
+}
+
+func endpointPort(ports []v1.EndpointPort, defaultPort string) string {
+	for _, port := range ports {
+		if port.Name == "vault" {
+			return strconv.Itoa(int(port.Port))
+		}
+	}
+	if len(ports) > 0 {
+		return strconv.Itoa(int(ports[0].Port))
+	}
+	if defaultPort != "" {
+		return defaultPort
+	}
+	return defaultVaultPort
+}
+
+func nodeAddress(scheme, ip, port string) string {
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(ip, port))
+}
+
+// vaultClientForAddress creates a Vault client for a node, the rest of the configuration is read from
+// the environment, as usual. Nodes are usually addressed by IP, so the TLS server name defaults
+// to the host in VAULT_ADDR, which is the one in the certificate.
+func vaultClientForAddress(address string) (*api.Client, error) {
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+
+	tlsConfig := config.HttpClient.Transport.(*http.Transport).TLSClientConfig
+	if tlsConfig.ServerName == "" {
+		vaultAddress, err := url.Parse(config.Address)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ServerName = vaultAddress.Hostname()
+	}
+
+	config.Address = address
+	return api.NewClient(config)
+}
+
+// forEachNode runs f concurrently on all the nodes and returns the results in the order of the nodes
+func forEachNode(nodes []vaultNode, f func(node vaultNode) error) []nodeResult {
+	results := make([]nodeResult, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node vaultNode) {
+			defer wg.Done()
+			results[i] = nodeResult{address: node.address, err: f(node)}
+		}(i, node)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// failedNodes returns an error listing the nodes which failed, or nil if none did
+func failedNodes(results []nodeResult) error {
+	failed := []string{}
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result.address)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d vault nodes failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -2,31 +2,46 @@ package main
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 	"text/template"
 	"time"
 
 	"github.com/Masterminds/sprig"
-	"github.com/jacohend/bank-vaults/pkg/vault"
 	"github.com/fsnotify/fsnotify"
 	"github.com/hashicorp/vault/api"
+	"github.com/jacohend/bank-vaults/pkg/vault"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 const cfgVaultConfigFile = "vault-config-file"
+const cfgPlan = "plan"
+const cfgDetailedExitCode = "detailed-exitcode"
+const cfgConfigurePeriod = "configure-period"
+
+const outputText = "text"
 
 var configureCmd = &cobra.Command{
 	Use:   "configure",
 	Short: "Configures a Vault based on a YAML/JSON configuration file",
 	Long: `This configuration is an extension to what is available through the Vault configuration:
 			https://www.vaultproject.io/docs/configuration/index.html. With this it is possible to
-			configure secret engines, auth methods, etc...`,
+			configure secret engines, auth methods, etc...
+
+			With --plan it only prints the changes it would make in Vault (in --output text or json format)
+			and exits, with --detailed-exitcode the exit code is 2 if there are changes.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		appConfig.BindPFlag(cfgUnsealPeriod, cmd.PersistentFlags().Lookup(cfgUnsealPeriod))
 		appConfig.BindPFlag(cfgVaultConfigFile, cmd.PersistentFlags().Lookup(cfgVaultConfigFile))
+		appConfig.BindPFlag(cfgPlan, cmd.PersistentFlags().Lookup(cfgPlan))
+		appConfig.BindPFlag(cfgOutput, cmd.PersistentFlags().Lookup(cfgOutput))
+		appConfig.BindPFlag(cfgDetailedExitCode, cmd.PersistentFlags().Lookup(cfgDetailedExitCode))
+		appConfig.BindPFlag(cfgConfigurePeriod, cmd.PersistentFlags().Lookup(cfgConfigurePeriod))
 
 		unsealConfig.unsealPeriod = appConfig.GetDuration(cfgUnsealPeriod)
 		vaultConfigFile := appConfig.GetString(cfgVaultConfigFile)
@@ -55,18 +70,13 @@ var configureCmd = &cobra.Command{
 			logrus.Fatalf("error creating vault helper: %s", err.Error())
 		}
 
-		parseConfiguration := func() {
-			configTemplate := template.Must(
-				template.New(path.Base(vaultConfigFile)).
-					Funcs(sprig.TxtFuncMap()).
-					Delims("${", "}").
-					ParseFiles(vaultConfigFile))
-
-			buffer := bytes.NewBuffer(nil)
+		// viper needs the config file to know its type
+		viper.SetConfigFile(vaultConfigFile)
 
-			err := configTemplate.Execute(buffer, nil)
+		parseConfiguration := func() {
+			buffer, err := renderConfigFile(vaultConfigFile)
 			if err != nil {
-				logrus.Fatalf("error executing vault config template: %s", err.Error())
+				logrus.Fatal(err.Error())
 			}
 
 			err = viper.ReadConfig(buffer)
@@ -75,8 +85,17 @@ var configureCmd = &cobra.Command{
 			}
 		}
 
+		if appConfig.GetBool(cfgPlan) {
+			parseConfiguration()
+			config, err := externalConfig()
+			if err != nil {
+				logrus.Fatal(err.Error())
+			}
+			printPlan(v, config, appConfig.GetString(cfgOutput), appConfig.GetBool(cfgDetailedExitCode))
+			return
+		}
+
 		c := make(chan fsnotify.Event, 1)
-		viper.SetConfigFile(vaultConfigFile)
 		go func() {
 			watcher, err := fsnotify.NewWatcher()
 			if err != nil {
@@ -117,8 +136,28 @@ var configureCmd = &cobra.Command{
 
 		c <- fsnotify.Event{Name: "Initial", Op: fsnotify.Create}
 
+		// the configuration is applied periodically as well, e.g. to rotate the AppRole secret IDs
+		if configurePeriod := appConfig.GetDuration(cfgConfigurePeriod); configurePeriod > 0 {
+			go func() {
+				for range time.Tick(configurePeriod) {
+					select {
+					case c <- fsnotify.Event{Name: "Periodic", Op: fsnotify.Write}:
+					default:
+						// a configuration is pending already
+					}
+				}
+			}()
+		}
+
 		for e := range c {
 			logrus.Infoln("New config file change", e.String())
+
+			config, err := externalConfig()
+			if err != nil {
+				logrus.Errorf("error parsing vault config: %s", err.Error())
+				continue
+			}
+
 			func() {
 				for {
 					logrus.Infof("checking if vault is sealed...")
@@ -137,7 +176,7 @@ var configureCmd = &cobra.Command{
 					}
 					logrus.Infof("vault is not sealed, configuring...")
 
-					if err = v.Configure(); err != nil {
+					if err = v.Configure(config); err != nil {
 						logrus.Errorf("error configuring vault: %s", err.Error())
 						return
 					}
@@ -150,9 +189,88 @@ var configureCmd = &cobra.Command{
 	},
 }
 
+// configTemplateFuncs are the functions of the config file template besides the sprig ones
+var configTemplateFuncs = template.FuncMap{
+	// file reads a credential or a certificate from a file, e.g. mounted from a Kubernetes Secret
+	"file": func(filename string) (string, error) {
+		content, err := ioutil.ReadFile(filename)
+		return string(content), err
+	},
+}
+
+// renderConfigFile executes the config file as a sprig template with ${ } delimiters
+func renderConfigFile(configFile string) (*bytes.Buffer, error) {
+	configTemplate, err := template.New(path.Base(configFile)).
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(configTemplateFuncs).
+		Delims("${", "}").
+		ParseFiles(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing vault config template: %s", err.Error())
+	}
+
+	buffer := bytes.NewBuffer(nil)
+
+	err = configTemplate.Execute(buffer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error executing vault config template: %s", err.Error())
+	}
+
+	return buffer, nil
+}
+
+// externalConfig decodes and validates the configuration read by viper
+func externalConfig() (*vault.ExternalConfig, error) {
+	config, unknownKeys, err := vault.ParseExternalConfig(viper.AllSettings())
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range unknownKeys {
+		logrus.Warnf("unknown key in vault config: %s", key)
+	}
+	return config, nil
+}
+
+// printPlan prints the changes Configure would make in Vault
+func printPlan(v vault.Vault, config *vault.ExternalConfig, output string, detailedExitCode bool) {
+	sealed, err := v.Sealed()
+	if err != nil {
+		logrus.Fatalf("error checking if vault is sealed: %s", err.Error())
+	}
+	if sealed {
+		logrus.Fatalf("vault is sealed, can't plan the configuration")
+	}
+
+	plan, err := v.Plan(config)
+	if err != nil {
+		logrus.Fatalf("error planning vault configuration: %s", err.Error())
+	}
+
+	switch output {
+	case outputJSON:
+		out, err := plan.JSON()
+		if err != nil {
+			logrus.Fatalf("error marshalling plan: %s", err.Error())
+		}
+		fmt.Println(string(out))
+	case outputText:
+		fmt.Print(plan.String())
+	default:
+		logrus.Fatalf("unsupported output format: '%s'", output)
+	}
+
+	if detailedExitCode && !plan.Empty() {
+		os.Exit(2)
+	}
+}
+
 func init() {
 	configureCmd.PersistentFlags().Duration(cfgUnsealPeriod, time.Second*30, "How often to attempt to unseal the Vault instance")
 	configureCmd.PersistentFlags().String(cfgVaultConfigFile, vault.DefaultConfigFile, "The filename of the YAML/JSON Vault configuration")
+	configureCmd.PersistentFlags().Bool(cfgPlan, false, "Print the changes the configuration would make in Vault and exit without changing anything")
+	configureCmd.PersistentFlags().StringP(cfgOutput, "o", outputText, fmt.Sprintf("Output format of the plan: '%s' or '%s'", outputText, outputJSON))
+	configureCmd.PersistentFlags().Bool(cfgDetailedExitCode, false, "Exit with code 2 if the plan contains changes")
+	configureCmd.PersistentFlags().Duration(cfgConfigurePeriod, 0, "How often to configure Vault even if the configuration doesn't change (e.g. to rotate AppRole secret IDs), 0 disables it")
 
 	rootCmd.AddCommand(configureCmd)
 }
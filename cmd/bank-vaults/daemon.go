@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// jitterFactor is the maximum fraction of a period added to it as random jitter
+const jitterFactor = 0.2
+
+// backoff implements a jittered exponential backoff between initial and max
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+func newBackoff(initial, max time.Duration) *backoff {
+	return &backoff{initial: initial, max: max}
+}
+
+// Next returns the duration to wait before the next attempt and doubles the backoff
+func (b *backoff) Next() time.Duration {
+	if b.current == 0 {
+		b.current = b.initial
+	} else {
+		b.current *= 2
+	}
+	if b.current > b.max {
+		b.current = b.max
+	}
+	next := wait.Jitter(b.current, jitterFactor)
+	if next > b.max {
+		next = b.max
+	}
+	return next
+}
+
+// Reset starts the backoff from the initial duration again
+func (b *backoff) Reset() {
+	b.current = 0
+}
+
+// stopOnSignal returns a channel which is closed when SIGTERM or SIGINT is received
+func stopOnSignal() <-chan struct{} {
+	stopCh := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logrus.Infof("received %s signal, shutting down...", sig)
+		close(stopCh)
+	}()
+	return stopCh
+}
+
+// sleepOrStop waits for the given duration, it returns false if stopCh was closed in the meantime
+func sleepOrStop(d time.Duration, stopCh <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stopCh:
+		return false
+	}
+}
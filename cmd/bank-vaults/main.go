@@ -51,6 +51,11 @@ const cfgAlibabaKMSKeyID = "alibaba-kms-key-id"
 const cfgK8SNamespace = "k8s-secret-namespace"
 const cfgK8SSecret = "k8s-secret-name"
 
+const cfgVaultAddresses = "vault-addresses"
+const cfgVaultK8SService = "vault-k8s-service"
+const cfgVaultK8SLabelSelector = "vault-k8s-label-selector"
+const cfgVaultK8SNamespace = "vault-k8s-namespace"
+
 var rootCmd = &cobra.Command{
 	Use:   "bank-vaults",
 	Short: "Automates initialization, unsealing and configuration of Hashicorp Vault.",
@@ -144,6 +149,12 @@ func init() {
 	// K8S Secret Storage flags
 	configStringVar(cfgK8SNamespace, "", "The namespace of the K8S Secret to store values in")
 	configStringVar(cfgK8SSecret, "", "The name of the K8S Secret to store values in")
+
+	// Vault cluster flags
+	configStringVar(cfgVaultAddresses, "", "Comma separated list of Vault node addresses to operate on, instead of VAULT_ADDR")
+	configStringVar(cfgVaultK8SService, "", "The name of the K8S Service to discover Vault nodes through its Endpoints")
+	configStringVar(cfgVaultK8SLabelSelector, "", "The K8S label selector to discover Vault nodes through Pods (eg. 'app=vault,vault_cr=vault')")
+	configStringVar(cfgVaultK8SNamespace, "", "The K8S namespace to discover Vault nodes in (defaults to the current namespace)")
 }
 
 func main() {
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jacohend/bank-vaults/pkg/kv"
+	"github.com/jacohend/bank-vaults/pkg/vault"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const cfgSealToken = "token"
+const cfgSealLock = "seal-lock"
+const cfgWatchdog = "watchdog"
+const cfgHeartbeatURL = "heartbeat-url"
+const cfgHeartbeatConfigMap = "heartbeat-configmap"
+const cfgHeartbeatAnnotation = "heartbeat-annotation"
+const cfgHeartbeatTimeout = "heartbeat-timeout"
+const cfgHeartbeatPeriod = "heartbeat-period"
+
+const defaultHeartbeatAnnotation = "bank-vaults/heartbeat"
+
+var sealCmd = &cobra.Command{
+	Use:   "seal",
+	Short: "Seals every node of the target Vault cluster.",
+	Long: `It seals the target Vault instance(s), using the token given with --token or VAULT_TOKEN,
+or the root token from the key store. The nodes of a cluster can be listed or discovered the same
+way as for the unseal command.
+
+Once a node has been sealed, a seal lock is stored in the key store as well, which prevents bank-vaults
+from unsealing Vault automatically until it is cleared with 'unseal --clear-seal-lock'. Without it the
+unseal daemon unseals Vault again within its --unseal-period, so only use --seal-lock=false if nothing
+unseals Vault automatically. The key store has to keep the lock, the dev one can't be used.
+
+With --watchdog it acts as a dead man's switch: it doesn't seal Vault right away, but watches a
+heartbeat and seals Vault if it doesn't arrive within --heartbeat-timeout. The heartbeat is either
+a successful (2xx) response from --heartbeat-url, or an RFC3339 timestamp in the --heartbeat-annotation
+annotation of the --heartbeat-configmap ConfigMap, which has to be refreshed periodically.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgSealToken, cmd.PersistentFlags().Lookup(cfgSealToken))
+		appConfig.BindPFlag(cfgSealLock, cmd.PersistentFlags().Lookup(cfgSealLock))
+		appConfig.BindPFlag(cfgWatchdog, cmd.PersistentFlags().Lookup(cfgWatchdog))
+		appConfig.BindPFlag(cfgHeartbeatURL, cmd.PersistentFlags().Lookup(cfgHeartbeatURL))
+		appConfig.BindPFlag(cfgHeartbeatConfigMap, cmd.PersistentFlags().Lookup(cfgHeartbeatConfigMap))
+		appConfig.BindPFlag(cfgHeartbeatAnnotation, cmd.PersistentFlags().Lookup(cfgHeartbeatAnnotation))
+		appConfig.BindPFlag(cfgHeartbeatTimeout, cmd.PersistentFlags().Lookup(cfgHeartbeatTimeout))
+		appConfig.BindPFlag(cfgHeartbeatPeriod, cmd.PersistentFlags().Lookup(cfgHeartbeatPeriod))
+
+		store, err := kvStoreForConfig(appConfig)
+
+		if err != nil {
+			logrus.Fatalf("error creating kv store: %s", err.Error())
+		}
+
+		if !appConfig.GetBool(cfgWatchdog) {
+			if err = seal(store, "sealed with the seal command"); err != nil {
+				logrus.Fatal(err.Error())
+			}
+			return
+		}
+
+		heartbeat, err := heartbeatForConfig()
+		if err != nil {
+			logrus.Fatalf("error configuring heartbeat: %s", err.Error())
+		}
+
+		watchdog(store, heartbeat, appConfig.GetDuration(cfgHeartbeatTimeout), appConfig.GetDuration(cfgHeartbeatPeriod))
+	},
+}
+
+// seal seals all the Vault nodes and locks them (if requested) if any of them got sealed
+func seal(store kv.Service, reason string) error {
+	nodes, err := vaultNodesForConfig(appConfig, store)
+	if err != nil {
+		return err
+	}
+
+	token := appConfig.GetString(cfgSealToken)
+
+	results := forEachNode(nodes, func(node vaultNode) error {
+		if token != "" {
+			node.client.SetToken(token)
+		}
+		return node.vault.Seal()
+	})
+
+	sealed := false
+	for _, result := range results {
+		log := logrus.WithField("node", result.address)
+		if result.err != nil {
+			log.Errorf("error sealing vault: %s", result.err.Error())
+		} else {
+			log.Infof("successfully sealed vault")
+			sealed = true
+		}
+	}
+
+	if sealed && appConfig.GetBool(cfgSealLock) {
+		if err := vault.LockSeal(store, reason); err != nil {
+			return err
+		}
+	}
+
+	return failedNodes(results)
+}
+
+// heartbeatFunc returns the time of the last heartbeat
+type heartbeatFunc func() (time.Time, error)
+
+func heartbeatForConfig() (heartbeatFunc, error) {
+	if heartbeatURL := appConfig.GetString(cfgHeartbeatURL); heartbeatURL != "" {
+		return httpHeartbeat(heartbeatURL), nil
+	}
+
+	if configMap := appConfig.GetString(cfgHeartbeatConfigMap); configMap != "" {
+		namespace := vault.KubernetesNamespace(appConfig.GetString(cfgVaultK8SNamespace))
+		return configMapHeartbeat(namespace, configMap, appConfig.GetString(cfgHeartbeatAnnotation))
+	}
+
+	return nil, fmt.Errorf("either --%s or --%s has to be set in watchdog mode", cfgHeartbeatURL, cfgHeartbeatConfigMap)
+}
+
+// httpHeartbeat treats every successful response of the URL as a heartbeat
+func httpHeartbeat(url string) heartbeatFunc {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func() (time.Time, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error getting heartbeat from %s: %s", url, err.Error())
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return time.Time{}, fmt.Errorf("error getting heartbeat from %s: %s", url, resp.Status)
+		}
+		return time.Now(), nil
+	}
+}
+
+// configMapHeartbeat reads the time of the last heartbeat from an annotation of a ConfigMap
+func configMapHeartbeat(namespace, name, annotation string) (heartbeatFunc, error) {
+	client, err := vault.KubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (time.Time, error) {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error getting heartbeat configmap '%s': %s", name, err.Error())
+		}
+
+		value, ok := configMap.Annotations[annotation]
+		if !ok {
+			return time.Time{}, fmt.Errorf("heartbeat annotation '%s' is missing from configmap '%s'", annotation, name)
+		}
+
+		heartbeat, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parsing heartbeat annotation '%s': %s", annotation, err.Error())
+		}
+		return heartbeat, nil
+	}, nil
+}
+
+// watchdog seals Vault if no heartbeat arrives within timeout, after sealing it waits
+// for a new heartbeat before arming itself again
+func watchdog(store kv.Service, heartbeat heartbeatFunc, timeout, period time.Duration) {
+	stopCh := stopOnSignal()
+
+	lastHeartbeat := time.Now()
+	tripped := false
+
+	logrus.Infof("watchdog started, vault will be sealed if no heartbeat arrives for %s", timeout)
+
+	for {
+		beat, err := heartbeat()
+		if err != nil {
+			logrus.Warnf("missed heartbeat: %s", err.Error())
+		} else if beat.After(lastHeartbeat) {
+			lastHeartbeat = beat
+			if tripped {
+				logrus.Infof("heartbeat arrived again, watchdog is armed again")
+				tripped = false
+			}
+		}
+
+		if !tripped && time.Since(lastHeartbeat) > timeout {
+			logrus.Warnf("no heartbeat since %s, sealing vault...", lastHeartbeat.Format(time.RFC3339))
+
+			reason := fmt.Sprintf("sealed by watchdog, no heartbeat since %s", lastHeartbeat.Format(time.RFC3339))
+			if err := seal(store, reason); err != nil {
+				logrus.Errorf("error sealing vault: %s", err.Error())
+			} else {
+				tripped = true
+			}
+		}
+
+		if !sleepOrStop(period, stopCh) {
+			return
+		}
+	}
+}
+
+func init() {
+	sealCmd.PersistentFlags().String(cfgSealToken, "", "The token to seal Vault with (defaults to VAULT_TOKEN or the root token in the key store)")
+	sealCmd.PersistentFlags().Bool(cfgSealLock, true, "Store a seal lock, which prevents bank-vaults from unsealing Vault automatically")
+	sealCmd.PersistentFlags().Bool(cfgWatchdog, false, "Seal Vault only if the heartbeat stops arriving")
+	sealCmd.PersistentFlags().String(cfgHeartbeatURL, "", "The URL which has to respond successfully as a heartbeat (only if -watchdog=true)")
+	sealCmd.PersistentFlags().String(cfgHeartbeatConfigMap, "", "The name of the K8S ConfigMap holding the heartbeat annotation (only if -watchdog=true)")
+	sealCmd.PersistentFlags().String(cfgHeartbeatAnnotation, defaultHeartbeatAnnotation, "The annotation of the heartbeat ConfigMap holding the RFC3339 time of the last heartbeat")
+	sealCmd.PersistentFlags().Duration(cfgHeartbeatTimeout, time.Minute*5, "Seal Vault if no heartbeat arrives for this long")
+	sealCmd.PersistentFlags().Duration(cfgHeartbeatPeriod, time.Second*30, "How often to check the heartbeat")
+
+	rootCmd.AddCommand(sealCmd)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/jacohend/bank-vaults/pkg/vault"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const cfgOutput = "output"
+
+const outputTable = "table"
+const outputJSON = "json"
+const outputYAML = "yaml"
+
+// Exit codes of the status command, the most severe problem of the cluster wins
+const (
+	statusExitOK             = 0
+	statusExitError          = 1
+	statusExitUnreachable    = 2
+	statusExitNotInitialized = 3
+	statusExitSealed         = 4
+)
+
+// clusterStatus is the status of the Vault nodes and the key store
+type clusterStatus struct {
+	Nodes         []nodeStatus      `json:"nodes"`
+	Keys          []vault.KeyStatus `json:"keys,omitempty"`
+	KeyStoreError string            `json:"keyStoreError,omitempty"`
+	SealLock      string            `json:"sealLock,omitempty"`
+}
+
+// nodeStatus is the status of a single Vault node
+type nodeStatus struct {
+	Address     string `json:"address"`
+	Reachable   bool   `json:"reachable"`
+	Initialized bool   `json:"initialized"`
+	Sealed      bool   `json:"sealed"`
+	Progress    int    `json:"progress"`
+	Threshold   int    `json:"threshold"`
+	Shares      int    `json:"shares"`
+	Version     string `json:"version,omitempty"`
+	ClusterName string `json:"clusterName,omitempty"`
+	HAEnabled   bool   `json:"haEnabled"`
+	Standby     bool   `json:"standby"`
+	Leader      string `json:"leader,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the status of the target Vault cluster and the key store.",
+	Long: `It shows the initialization, seal and HA status of the target Vault instance(s), and which
+unseal keys and root token are present in the key store. The nodes of a cluster can be listed or
+discovered the same way as for the unseal command.
+
+Exit codes:
+  0 - every node is initialized and unsealed
+  1 - the status couldn't be checked
+  2 - at least one node is unreachable
+  3 - at least one node is not initialized
+  4 - at least one node is sealed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgOutput, cmd.PersistentFlags().Lookup(cfgOutput))
+		output := appConfig.GetString(cfgOutput)
+
+		if output != outputTable && output != outputJSON && output != outputYAML {
+			logrus.Errorf("unsupported output format: '%s'", output)
+			os.Exit(statusExitError)
+		}
+
+		status := clusterStatus{}
+
+		// the Vault status is useful even if the key store is not accessible
+		store, err := kvStoreForConfig(appConfig)
+		if err != nil {
+			status.KeyStoreError = err.Error()
+		}
+
+		nodes, err := vaultNodesForConfig(appConfig, store)
+		if err != nil {
+			logrus.Errorf("error listing vault nodes: %s", err.Error())
+			os.Exit(statusExitError)
+		}
+
+		index := map[string]int{}
+		for i, node := range nodes {
+			index[node.address] = i
+		}
+
+		status.Nodes = make([]nodeStatus, len(nodes))
+		forEachNode(nodes, func(node vaultNode) error {
+			status.Nodes[index[node.address]] = statusOfNode(node)
+			return nil
+		})
+
+		if store != nil {
+			shares := appConfig.GetInt(cfgSecretShares)
+			for _, node := range status.Nodes {
+				if node.Shares > 0 {
+					shares = node.Shares
+					break
+				}
+			}
+			status.Keys = nodes[0].vault.KeyStoreStatus(shares)
+
+			status.SealLock, err = vault.SealLock(store)
+			if err != nil {
+				status.KeyStoreError = err.Error()
+			}
+		}
+
+		if err := printStatus(status, output); err != nil {
+			logrus.Errorf("error printing status: %s", err.Error())
+			os.Exit(statusExitError)
+		}
+
+		os.Exit(status.exitCode())
+	},
+}
+
+func statusOfNode(node vaultNode) nodeStatus {
+	status := nodeStatus{Address: node.address}
+
+	health, err := node.client.Sys().Health()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Reachable = true
+	status.Initialized = health.Initialized
+	status.Sealed = health.Sealed
+	status.Standby = health.Standby
+	status.Version = health.Version
+	status.ClusterName = health.ClusterName
+
+	sealStatus, err := node.client.Sys().SealStatus()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Progress = sealStatus.Progress
+	status.Threshold = sealStatus.T
+	status.Shares = sealStatus.N
+
+	// the leader is only known by unsealed nodes
+	if status.Initialized && !status.Sealed {
+		leader, err := node.client.Sys().Leader()
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		status.HAEnabled = leader.HAEnabled
+		status.Leader = leader.LeaderAddress
+	}
+
+	return status
+}
+
+func (s *clusterStatus) exitCode() int {
+	code := statusExitOK
+	for _, node := range s.Nodes {
+		switch {
+		case !node.Reachable:
+			return statusExitUnreachable
+		case !node.Initialized:
+			code = statusExitNotInitialized
+		case node.Sealed && code != statusExitNotInitialized:
+			code = statusExitSealed
+		}
+	}
+	return code
+}
+
+func printStatus(status clusterStatus, output string) error {
+	switch output {
+	case outputJSON:
+		out, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case outputYAML:
+		out, err := yaml.Marshal(status)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	default:
+		printStatusTable(status)
+	}
+	return nil
+}
+
+func printStatusTable(status clusterStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "NODE\tINITIALIZED\tSEALED\tPROGRESS\tHA MODE\tLEADER\tVERSION\tERROR")
+	for _, node := range status.Nodes {
+		haMode := "disabled"
+		if node.HAEnabled {
+			haMode = "active"
+			if node.Standby {
+				haMode = "standby"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%t\t%t\t%d/%d\t%s\t%s\t%s\t%s\n",
+			node.Address, node.Initialized, node.Sealed, node.Progress, node.Threshold,
+			haMode, node.Leader, node.Version, singleLine(node.Error))
+	}
+	fmt.Fprintln(w)
+
+	if status.KeyStoreError != "" {
+		fmt.Fprintf(w, "KEY STORE ERROR: %s\n", status.KeyStoreError)
+	}
+	if status.SealLock != "" {
+		fmt.Fprintf(w, "SEAL LOCK: %s\n", status.SealLock)
+	}
+
+	if len(status.Keys) > 0 {
+		fmt.Fprintln(w, "KEY\tPRESENT\tERROR")
+		for _, key := range status.Keys {
+			fmt.Fprintf(w, "%s\t%t\t%s\n", key.Key, key.Exists, singleLine(key.Error))
+		}
+	}
+
+	w.Flush()
+}
+
+// singleLine squashes the multi-line Vault API errors for the table output
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func init() {
+	statusCmd.PersistentFlags().StringP(cfgOutput, "o", outputTable, fmt.Sprintf("Output format: '%s', '%s' or '%s'", outputTable, outputJSON, outputYAML))
+
+	rootCmd.AddCommand(statusCmd)
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
-	"github.com/hashicorp/vault/api"
+	"fmt"
+	"time"
+
+	"github.com/jacohend/bank-vaults/pkg/kv"
 	"github.com/jacohend/bank-vaults/pkg/vault"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"os"
-	"time"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 const cfgUnsealPeriod = "unseal-period"
+const cfgUnsealMaxBackoff = "unseal-max-backoff"
 const cfgInit = "init"
+const cfgOnce = "once"
+const cfgClearSealLock = "clear-seal-lock"
 
 type unsealCfg struct {
 	unsealPeriod time.Duration
+	maxBackoff   time.Duration
 	proceedInit  bool
+	once         bool
 }
 
 var unsealConfig unsealCfg
@@ -22,19 +29,34 @@ var unsealConfig unsealCfg
 var unsealCmd = &cobra.Command{
 	Use:   "unseal",
 	Short: "Unseals Vault with with unseal keys stored in one of the supported Cloud Provider options.",
-	Long: `It will continuously attempt to unseal the target Vault instance, by retrieving unseal keys
-from one of the followings:
+	Long: `It will continuously watch the seal status of the target Vault instance(s), and unseal them
+whenever they become sealed, by retrieving unseal keys from one of the followings:
 - Google Cloud KMS keyring (backed by GCS)
 - AWS KMS keyring (backed by S3)
 - Azure Key Vault
-- Kubernetes Secrets (should be used only for development purposes)`,
+- Kubernetes Secrets (should be used only for development purposes)
+
+All nodes of an HA cluster can be unsealed concurrently, either listed with --vault-addresses
+or discovered through a Kubernetes Service (--vault-k8s-service) or label selector
+(--vault-k8s-label-selector), otherwise VAULT_ADDR is used.
+
+Failed attempts are retried with a jittered exponential backoff. With --once it makes
+a single attempt and exits with a non-zero status if Vault could not be unsealed,
+which is useful for Kubernetes Jobs.
+
+Vault sealed by the seal command is not unsealed until the seal lock is cleared with --clear-seal-lock.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		appConfig.BindPFlag(cfgUnsealPeriod, cmd.PersistentFlags().Lookup(cfgUnsealPeriod))
+		appConfig.BindPFlag(cfgUnsealMaxBackoff, cmd.PersistentFlags().Lookup(cfgUnsealMaxBackoff))
 		appConfig.BindPFlag(cfgInit, cmd.PersistentFlags().Lookup(cfgInit))
+		appConfig.BindPFlag(cfgOnce, cmd.PersistentFlags().Lookup(cfgOnce))
+		appConfig.BindPFlag(cfgClearSealLock, cmd.PersistentFlags().Lookup(cfgClearSealLock))
 		appConfig.BindPFlag(cfgInitRootToken, cmd.PersistentFlags().Lookup(cfgInitRootToken))
 		appConfig.BindPFlag(cfgStoreRootToken, cmd.PersistentFlags().Lookup(cfgStoreRootToken))
 		unsealConfig.unsealPeriod = appConfig.GetDuration(cfgUnsealPeriod)
+		unsealConfig.maxBackoff = appConfig.GetDuration(cfgUnsealMaxBackoff)
 		unsealConfig.proceedInit = appConfig.GetBool(cfgInit)
+		unsealConfig.once = appConfig.GetBool(cfgOnce)
 
 		store, err := kvStoreForConfig(appConfig)
 
@@ -42,66 +64,109 @@ from one of the followings:
 			logrus.Fatalf("error creating kv store: %s", err.Error())
 		}
 
-		cl, err := api.NewClient(nil)
+		if appConfig.GetBool(cfgClearSealLock) {
+			if err = vault.ClearSealLock(store); err != nil {
+				logrus.Fatal(err.Error())
+			}
+			logrus.Infof("seal lock cleared")
+		}
 
-		if err != nil {
-			logrus.Fatalf("error connecting to vault: %s", err.Error())
+		if unsealConfig.once {
+			if err = unseal(store); err != nil {
+				logrus.Fatal(err.Error())
+			}
+			return
 		}
 
-		vaultConfig, err := vaultConfigForConfig(appConfig)
+		stopCh := stopOnSignal()
+		retry := newBackoff(time.Second, unsealConfig.maxBackoff)
 
-		if err != nil {
-			logrus.Fatalf("error building vault config: %s", err.Error())
-		}
+		for {
+			delay := wait.Jitter(unsealConfig.unsealPeriod, jitterFactor)
 
-		v, err := vault.New(store, cl, vaultConfig)
+			if err = unseal(store); err != nil {
+				delay = retry.Next()
+				logrus.Errorf("%s, waiting %s before trying again...", err.Error(), delay)
+			} else {
+				retry.Reset()
+			}
 
-		if err != nil {
-			logrus.Fatalf("error creating vault helper: %s", err.Error())
+			if !sleepOrStop(delay, stopCh) {
+				return
+			}
+		}
+	},
+}
+
+// unseal makes a single attempt to initialize (if requested) and unseal all the Vault nodes,
+// it is a no-op for nodes which are already unsealed
+func unseal(store kv.Service) error {
+	lock, err := vault.SealLock(store)
+	if err != nil {
+		return err
+	}
+
+	if lock != "" {
+		if unsealConfig.once {
+			return fmt.Errorf("vault is locked sealed (%s), use --%s to unseal it", lock, cfgClearSealLock)
 		}
+		logrus.Warnf("vault is locked sealed (%s), not unsealing until the lock is cleared with --%s", lock, cfgClearSealLock)
+		return nil
+	}
+
+	nodes, err := vaultNodesForConfig(appConfig, store)
+	if err != nil {
+		return err
+	}
+
+	if unsealConfig.proceedInit {
+		// the nodes of a cluster share the same storage, so it is enough to initialize one of them
+		logrus.Infof("initializing vault...")
+		if err := nodes[0].vault.Init(); err != nil {
+			return fmt.Errorf("error initializing vault: %s", err.Error())
+		}
+		unsealConfig.proceedInit = false
+	}
 
-		for i := 0; i <= 3; i++ {
-			func() {
-				if unsealConfig.proceedInit {
-					logrus.Infof("initializing vault...")
-					if err = v.Init(); err != nil {
-						logrus.Fatalf("error initializing vault: %s", err.Error())
-					} else {
-						unsealConfig.proceedInit = false
-					}
-				}
-
-				logrus.Infof("checking if vault is sealed...")
-				sealed, err := v.Sealed()
-				if err != nil {
-					logrus.Errorf("error checking if vault is sealed: %s", err.Error())
-				}
-
-				logrus.Infof("vault sealed: %t", sealed)
-
-				// If vault is not sealed, we stop here and wait another unsealPeriod
-				if !sealed {
-					os.Exit(0)
-				}
-
-				if err = v.Unseal(); err != nil {
-					logrus.Errorf("error unsealing vault: %s", err.Error())
-					os.Exit(1)
-				} else {
-					logrus.Infof("successfully unsealed vault")
-					os.Exit(0)
-				}
-			}()
-			// wait unsealPeriod before trying again
-			time.Sleep(unsealConfig.unsealPeriod)
+	results := forEachNode(nodes, unsealNode)
+	for _, result := range results {
+		if result.err != nil {
+			logrus.WithField("node", result.address).Errorf("error unsealing vault: %s", result.err.Error())
 		}
-		os.Exit(1)
-	},
+	}
+
+	return failedNodes(results)
+}
+
+func unsealNode(node vaultNode) error {
+	log := logrus.WithField("node", node.address)
+
+	log.Debugf("checking if vault is sealed...")
+	sealed, err := node.vault.Sealed()
+	if err != nil {
+		return fmt.Errorf("error checking if vault is sealed: %s", err.Error())
+	}
+
+	if !sealed {
+		log.Debugf("vault is not sealed")
+		return nil
+	}
+
+	log.Infof("vault is sealed, unsealing...")
+	if err = node.vault.Unseal(); err != nil {
+		return err
+	}
+
+	log.Infof("successfully unsealed vault")
+	return nil
 }
 
 func init() {
-	unsealCmd.PersistentFlags().Duration(cfgUnsealPeriod, time.Second*30, "How often to attempt to unseal the vault instance")
+	unsealCmd.PersistentFlags().Duration(cfgUnsealPeriod, time.Second*30, "How often to check the seal status of the vault instance")
+	unsealCmd.PersistentFlags().Duration(cfgUnsealMaxBackoff, time.Minute*2, "The maximum time to wait between failed unseal attempts")
 	unsealCmd.PersistentFlags().Bool(cfgInit, false, "Initialize vault instantce if not yet initialized")
+	unsealCmd.PersistentFlags().Bool(cfgOnce, false, "Make a single unseal attempt and exit instead of watching the seal status")
+	unsealCmd.PersistentFlags().Bool(cfgClearSealLock, false, "Clear the seal lock left behind by the seal command, to allow unsealing again")
 	unsealCmd.PersistentFlags().String(cfgInitRootToken, "", "root token for the new vault cluster (only if -init=true)")
 	unsealCmd.PersistentFlags().Bool(cfgStoreRootToken, true, "should the root token be stored in the key store (only if -init=true)")
 
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jacohend/bank-vaults/pkg/vault"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// knownAuthTypes, knownSecretTypes and knownAuditTypes are the auth methods, secret engines and audit devices built into Vault
+var knownAuthTypes = []string{
+	"alicloud", "app-id", "approle", "aws", "azure", "centrify", "cert", "gcp", "github",
+	"jwt", "kubernetes", "ldap", "oidc", "okta", "plugin", "radius", "token", "userpass",
+}
+var knownSecretTypes = []string{
+	"ad", "alicloud", "aws", "azure", "cassandra", "consul", "cubbyhole", "database", "gcp",
+	"generic", "identity", "kv", "mongodb", "mssql", "mysql", "nomad", "pki", "plugin",
+	"postgresql", "rabbitmq", "ssh", "totp", "transit",
+}
+var knownAuditTypes = []string{"file", "socket", "syslog"}
+
+// credentialFields are the (suffixes of the) names of the fields holding credentials
+var credentialFields = []string{
+	"password", "secret", "secret_key", "secret_id", "token", "jwt", "private_key", "credentials", "bindpass",
+}
+
+// minCredentialLength is the length of the shortest value reported as a literal credential
+const minCredentialLength = 8
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates a Vault configuration file without connecting to Vault.",
+	Long: `It renders the configuration file as a template the same way as the configure command does,
+and checks the result against the configuration schema, including the HCL rules of the policies.
+It warns about unknown auth method, secret engine and audit device types, and about credentials written into
+the file literally instead of being read from the environment or a file by the template.
+
+It exits with a non-zero exit code if the configuration is invalid, so it can be used in CI.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig.BindPFlag(cfgVaultConfigFile, cmd.PersistentFlags().Lookup(cfgVaultConfigFile))
+		vaultConfigFile := appConfig.GetString(cfgVaultConfigFile)
+
+		warnings, err := validateConfigFile(vaultConfigFile)
+		for _, warning := range warnings {
+			logrus.Warn(warning)
+		}
+		if err != nil {
+			logrus.Fatalf("%s is invalid: %s", vaultConfigFile, err.Error())
+		}
+
+		logrus.Infof("%s is valid", vaultConfigFile)
+	},
+}
+
+// validateConfigFile renders, parses and validates the config file, it returns
+// the problems which don't prevent applying the configuration as warnings
+func validateConfigFile(configFile string) ([]string, error) {
+	source, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading vault config file: %s", err.Error())
+	}
+
+	buffer, err := renderConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	v := viper.New()
+	v.SetConfigType(strings.TrimPrefix(filepath.Ext(configFile), "."))
+	err = v.ReadConfig(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("error reading vault config file: %s", err.Error())
+	}
+
+	config, unknownKeys, err := vault.ParseExternalConfig(v.AllSettings())
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := []string{}
+	for _, key := range unknownKeys {
+		warnings = append(warnings, fmt.Sprintf("%s is an unknown key", key))
+	}
+
+	for i, authMethod := range config.Auth {
+		if !contains(knownAuthTypes, authMethod.Type) {
+			warnings = append(warnings, fmt.Sprintf("auth[%d].type '%s' is not a builtin auth method", i, authMethod.Type))
+		}
+		warnings = append(warnings, literalCredentials(source, fmt.Sprintf("auth[%d].config", i), authMethod.Config)...)
+		for j, role := range authMethod.Roles {
+			warnings = append(warnings, literalCredentials(source, fmt.Sprintf("auth[%d].roles[%d]", i, j), role)...)
+		}
+		for section, items := range authMethod.Sections {
+			for j, item := range items {
+				warnings = append(warnings, literalCredentials(source, fmt.Sprintf("auth[%d].%s[%d]", i, section, j), item)...)
+			}
+		}
+	}
+
+	for i, secretEngine := range config.Secrets {
+		if secretEngine.PluginName == "" && !contains(knownSecretTypes, secretEngine.Type) {
+			warnings = append(warnings, fmt.Sprintf("secrets[%d].type '%s' is not a builtin secret engine", i, secretEngine.Type))
+		}
+		for configOption, items := range secretEngine.Configuration {
+			for j, item := range items {
+				path := fmt.Sprintf("secrets[%d].configuration.%s[%d]", i, configOption, j)
+				warnings = append(warnings, literalCredentials(source, path, item)...)
+			}
+		}
+		for j, enginePath := range secretEngine.Paths {
+			path := fmt.Sprintf("secrets[%d].paths[%d].data", i, j)
+			warnings = append(warnings, literalCredentials(source, path, enginePath.Data)...)
+		}
+	}
+
+	for i, auditDevice := range config.Audit {
+		if !contains(knownAuditTypes, auditDevice.Type) {
+			warnings = append(warnings, fmt.Sprintf("audit[%d].type '%s' is not a builtin audit device", i, auditDevice.Type))
+		}
+	}
+
+	for i, token := range config.Tokens {
+		if isLiteral(source, "id", token.ID) {
+			warnings = append(warnings, fmt.Sprintf("tokens[%d].id is a literal credential, consider reading it with ${ env } or ${ file }", i))
+		}
+	}
+
+	for i, startupSecret := range config.StartupSecrets {
+		warnings = append(warnings, literalCredentials(source, fmt.Sprintf("startupSecrets[%d].data", i), startupSecret.Data)...)
+	}
+
+	sort.Strings(warnings)
+	return warnings, nil
+}
+
+// literalCredentials returns warnings about the credential fields of data, which
+// are written into the source literally instead of being rendered by the template
+func literalCredentials(source []byte, path string, data map[string]interface{}) []string {
+	warnings := []string{}
+	for key, value := range data {
+		if nested, ok := value.(map[string]interface{}); ok {
+			warnings = append(warnings, literalCredentials(source, path+"."+key, nested)...)
+			continue
+		}
+
+		if !isCredentialField(key) {
+			continue
+		}
+
+		if isLiteral(source, key, cast.ToString(value)) {
+			warnings = append(warnings, fmt.Sprintf("%s.%s is a literal credential, consider reading it with ${ env } or ${ file }", path, key))
+		}
+	}
+	return warnings
+}
+
+// isLiteral checks whether the value is written into the source literally as the value of the key,
+// values shorter than minCredentialLength (e.g. "true" or "1") aren't considered to be credentials
+func isLiteral(source []byte, key, value string) bool {
+	if len(value) < minCredentialLength {
+		return false
+	}
+	pattern := fmt.Sprintf(`(?m)["']?(?i:%s)["']?\s*:\s*["']?%s["']?\s*(,|#|$)`, regexp.QuoteMeta(key), regexp.QuoteMeta(value))
+	return regexp.MustCompile(pattern).Match(source)
+}
+
+func isCredentialField(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range credentialFields {
+		if key == field || strings.HasSuffix(key, "_"+field) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	validateCmd.PersistentFlags().String(cfgVaultConfigFile, vault.DefaultConfigFile, "The filename of the YAML/JSON Vault configuration")
+
+	rootCmd.AddCommand(validateCmd)
+}
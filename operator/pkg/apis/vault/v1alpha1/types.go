@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
 
+	"github.com/jacohend/bank-vaults/pkg/vault"
 	"github.com/spf13/cast"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -102,6 +103,12 @@ func (spec *VaultSpec) ConfigJSON() string {
 	return string(config)
 }
 
+// GetExternalConfig decodes and validates the ExternalConfig field, which is kept in its generic form so
+// that it is passed to the configurer as it is, it returns the keys unknown to this version as well
+func (spec *VaultSpec) GetExternalConfig() (*vault.ExternalConfig, []string, error) {
+	return vault.ParseExternalConfig(spec.ExternalConfig)
+}
+
 // ExternalConfigJSON returns the ExternalConfig field as a JSON string
 func (spec *VaultSpec) ExternalConfigJSON() string {
 	config, _ := json.Marshal(spec.ExternalConfig)
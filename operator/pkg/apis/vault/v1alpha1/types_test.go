@@ -0,0 +1,38 @@
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExternalConfig(t *testing.T) {
+	spec := VaultSpec{
+		ExternalConfig: map[string]interface{}{
+			"policies": []interface{}{
+				map[string]interface{}{"name": "allow_secrets", "rules": `path "secret/*" { capabilities = ["read"] }`},
+			},
+			"futureSection": map[string]interface{}{"enabled": true},
+		},
+	}
+
+	config, unknownKeys, err := spec.GetExternalConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Policies) != 1 || config.Policies[0].Name != "allow_secrets" {
+		t.Errorf("expected the allow_secrets policy, got %+v", config.Policies)
+	}
+	if len(unknownKeys) != 1 || unknownKeys[0] != "futureSection" {
+		t.Errorf("expected futureSection to be reported as unknown, got %v", unknownKeys)
+	}
+
+	// unknown keys are passed to the configurer as they are
+	if !strings.Contains(spec.ExternalConfigJSON(), `"futureSection":{"enabled":true}`) {
+		t.Errorf("expected futureSection in %s", spec.ExternalConfigJSON())
+	}
+
+	spec.ExternalConfig["policies"] = []interface{}{map[string]interface{}{"rules": "path {"}}
+	if _, _, err := spec.GetExternalConfig(); err == nil {
+		t.Error("expected an invalid externalConfig")
+	}
+}
@@ -50,6 +50,14 @@ func (h *Handler) Handle(ctx types.Context, event types.Event) error {
 			return nil
 		}
 
+		_, unknownKeys, err := v.Spec.GetExternalConfig()
+		if err != nil {
+			return fmt.Errorf("invalid externalConfig: %v", err)
+		}
+		for _, key := range unknownKeys {
+			logrus.Warnf("unknown key in externalConfig of %s, it is passed to the configurer as it is: %s", v.Name, key)
+		}
+
 		// check if we need to create an etcd cluster
 		if v.Spec.GetStorageType() == "etcd" {
 
@@ -16,6 +16,7 @@ type alibabaKMS struct {
 }
 
 var _ kv.Service = &alibabaKMS{}
+var _ kv.Checker = &alibabaKMS{}
 
 // New creates a new kv.Service encrypted by Alibaba KMS
 func New(regionID, accessKeyID, accessKeySecret, kmsID string, store kv.Service) (kv.Service, error) {
@@ -88,3 +89,8 @@ func (a *alibabaKMS) Test(key string) error {
 
 	return nil
 }
+
+// Exists checks the encrypted value in the backend store, without decrypting it
+func (a *alibabaKMS) Exists(key string) (bool, error) {
+	return kv.Exists(a.store, key)
+}
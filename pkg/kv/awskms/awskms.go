@@ -17,6 +17,7 @@ type awsKMS struct {
 }
 
 var _ kv.Service = &awsKMS{}
+var _ kv.Checker = &awsKMS{}
 
 // NewWithSession creates a new kv.Service encrypted by AWS KMS with and existing AWS Session
 func NewWithSession(sess *session.Session, store kv.Service, kmsID string) (kv.Service, error) {
@@ -106,3 +107,8 @@ func (a *awsKMS) Test(key string) error {
 
 	return nil
 }
+
+// Exists checks the encrypted value in the backend store, without decrypting it
+func (a *awsKMS) Exists(key string) (bool, error) {
+	return kv.Exists(a.store, key)
+}
@@ -20,6 +20,7 @@ type googleKms struct {
 }
 
 var _ kv.Service = &googleKms{}
+var _ kv.Checker = &googleKms{}
 
 // New creates a new kv.Service encrypted by Google KMS
 func New(store kv.Service, project, location, keyring, cryptoKey string) (kv.Service, error) {
@@ -91,3 +92,8 @@ func (g *googleKms) Test(key string) error {
 	// TODO: Implement me properly
 	return nil
 }
+
+// Exists checks the encrypted value in the backend store, without decrypting it
+func (g *googleKms) Exists(key string) (bool, error) {
+	return kv.Exists(g.store, key)
+}
@@ -100,7 +100,7 @@ func (k *k8sStorage) Get(key string) ([]byte, error) {
 
 	val := secret.Data[key]
 	if val == nil {
-		return nil, kv.NewNotFoundError("key '%s' is not present in secret: %s", key)
+		return nil, kv.NewNotFoundError("key '%s' is not present in secret", key)
 	}
 
 	return val, nil
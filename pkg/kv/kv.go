@@ -23,3 +23,28 @@ type Service interface {
 	Get(key string) ([]byte, error)
 	Test(key string) error
 }
+
+// Checker is implemented by the key stores which can tell whether a key is present
+// without reading (and decrypting) its value
+type Checker interface {
+	Exists(key string) (bool, error)
+}
+
+// Exists tells whether the key is present in the key store, the values read by
+// key stores which can't check it otherwise are erased right away
+func Exists(store Service, key string) (bool, error) {
+	if checker, ok := store.(Checker); ok {
+		return checker.Exists(key)
+	}
+
+	value, err := store.Get(key)
+	for i := range value {
+		value[i] = 0
+	}
+	if _, ok := err.(*NotFoundError); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,221 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacohend/bank-vaults/pkg/kv"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// appRoleKeyPrefix is the prefix of the key store keys recording the delivered secret IDs
+const appRoleKeyPrefix = "vault-approle-"
+
+// appRoleSecretID is the record of the last secret ID delivered for an approle role
+type appRoleSecretID struct {
+	Accessor string    `json:"secret_id_accessor"`
+	Issued   time.Time `json:"issued"`
+	// WrapExpires is when the wrapping token of the secret ID expires, if it was response wrapped
+	WrapExpires time.Time `json:"wrap_expires,omitempty"`
+}
+
+// due checks whether a new secret ID has to be delivered: if none was delivered yet, once the wrapping
+// token of the last one has expired (it might have been unwrapped already) or after the rotation period
+func (r *appRoleSecretID) due(credentials *AppRoleCredentials) bool {
+	if r == nil || r.Issued.IsZero() {
+		return true
+	}
+	if !r.WrapExpires.IsZero() && time.Now().After(r.WrapExpires) {
+		return true
+	}
+	if credentials.RotationPeriod == "" {
+		return false
+	}
+	rotationPeriod, _ := time.ParseDuration(credentials.RotationPeriod)
+	return time.Since(r.Issued) >= rotationPeriod
+}
+
+// withoutAppRoleCredentials returns the approle roles without their credentials, which are not sent to Vault
+func withoutAppRoleCredentials(roles []map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(roles))
+	for _, role := range roles {
+		if _, ok := role[appRoleCredentialsKey]; ok {
+			copied := map[string]interface{}{}
+			for key, value := range role {
+				if key != appRoleCredentialsKey {
+					copied[key] = value
+				}
+			}
+			role = copied
+		}
+		result = append(result, role)
+	}
+	return result
+}
+
+// deliverAppRoleCredentials delivers the role ID and a new secret ID of the approle roles with credentials,
+// if none was delivered yet or the rotation period of the last one is over
+func (v *vault) deliverAppRoleCredentials(path string, roles []map[string]interface{}) error {
+	for _, role := range roles {
+		credentials, err := appRoleCredentials(role)
+		if err != nil {
+			return err
+		}
+		if credentials == nil {
+			continue
+		}
+
+		name := cast.ToString(role["name"])
+		err = v.deliverAppRoleCredential(path, name, credentials)
+		if err != nil {
+			return fmt.Errorf("error delivering credentials of %s approle role: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (v *vault) deliverAppRoleCredential(path, name string, credentials *AppRoleCredentials) error {
+	rolePath := fmt.Sprintf("auth/%s/role/%s", path, name)
+	recordKey := appRoleKeyPrefix + strings.Replace(strings.Trim(path, "/"), "/", "-", -1) + "-" + name
+
+	previous, err := v.appRoleSecretID(recordKey)
+	if err != nil {
+		return err
+	}
+	if !previous.due(credentials) {
+		return nil
+	}
+
+	if v.plan != nil {
+		v.plan.add(ActionCreate, rolePath+"/secret-id")
+		return nil
+	}
+
+	// an empty record is written first, so that key stores which don't keep it (e.g. the dev one) are
+	// detected before delivering, otherwise a new secret ID would be generated on every run
+	if previous == nil {
+		err := v.keepRecord(recordKey, []byte("{}"))
+		if err != nil {
+			return fmt.Errorf("error recording secret ID in key store: %s", err.Error())
+		}
+		previous = &appRoleSecretID{}
+	}
+
+	roleID, err := v.cl.Logical().Read(rolePath + "/role-id")
+	if err != nil {
+		return fmt.Errorf("error reading role ID: %s", err.Error())
+	}
+	if roleID == nil || roleID.Data["role_id"] == nil {
+		return fmt.Errorf("error reading role ID: the role doesn't exist")
+	}
+
+	logrus.Infof("generating a new secret ID for %s", rolePath)
+	secretID, err := v.cl.Logical().Write(rolePath+"/secret-id", map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("error generating secret ID: %s", err.Error())
+	}
+	if secretID == nil || secretID.Data["secret_id"] == nil {
+		return fmt.Errorf("error generating secret ID: no secret ID returned")
+	}
+
+	record := appRoleSecretID{
+		Accessor: cast.ToString(secretID.Data["secret_id_accessor"]),
+		Issued:   time.Now().UTC(),
+	}
+	delivered := map[string]string{
+		"role_id":   cast.ToString(roleID.Data["role_id"]),
+		"secret_id": cast.ToString(secretID.Data["secret_id"]),
+	}
+	if credentials.WrapTTL != "" {
+		wrapTTL, _ := time.ParseDuration(credentials.WrapTTL)
+		record.WrapExpires = record.Issued.Add(wrapTTL)
+		token, err := v.wrap(credentials.WrapTTL, map[string]interface{}{"secret_id": delivered["secret_id"]})
+		if err != nil {
+			return fmt.Errorf("error wrapping secret ID: %s", err.Error())
+		}
+		delete(delivered, "secret_id")
+		delivered["secret_id_wrapping_token"] = token
+	}
+
+	if credentials.K8sSecret != nil {
+		data := map[string][]byte{}
+		for key, value := range delivered {
+			data[key] = []byte(value)
+		}
+		err := writeKubernetesSecret(credentials.K8sSecret.Namespace, credentials.K8sSecret.Name, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if credentials.KV != "" {
+		for key, value := range delivered {
+			kvKey := credentials.KV + "-" + strings.Replace(key, "_", "-", -1)
+			err := v.keyStore.Set(kvKey, []byte(value))
+			if err != nil {
+				return fmt.Errorf("error storing %s in key store: %s", kvKey, err.Error())
+			}
+		}
+	}
+
+	recorded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	err = v.keyStore.Set(recordKey, recorded)
+	if err != nil {
+		return fmt.Errorf("error recording secret ID in key store: %s", err.Error())
+	}
+
+	// the previous secret ID is destroyed only after the new one has been delivered
+	if previous.Accessor != "" {
+		_, err := v.cl.Logical().Write(rolePath+"/secret-id-accessor/destroy", map[string]interface{}{"secret_id_accessor": previous.Accessor})
+		if err != nil {
+			logrus.Warnf("error destroying the previous secret ID of %s: %s", rolePath, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// appRoleSecretID returns the record of the last delivered secret ID, or nil if there is none
+func (v *vault) appRoleSecretID(key string) (*appRoleSecretID, error) {
+	data, err := v.keyStore.Get(key)
+	if _, ok := err.(*kv.NotFoundError); ok {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s from key store: %s", key, err.Error())
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	record := appRoleSecretID{}
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s from key store: %s", key, err.Error())
+	}
+	return &record, nil
+}
+
+// wrap response wraps the data with sys/wrapping/wrap, it returns the wrapping token
+func (v *vault) wrap(ttl string, data map[string]interface{}) (string, error) {
+	cl, err := v.cl.Clone()
+	if err != nil {
+		return "", err
+	}
+	cl.SetToken(v.cl.Token())
+	cl.SetWrappingLookupFunc(func(operation, path string) string { return ttl })
+
+	secret, err := cl.Logical().Write("sys/wrapping/wrap", data)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.WrapInfo == nil {
+		return "", fmt.Errorf("no wrapping token returned")
+	}
+	return secret.WrapInfo.Token, nil
+}
@@ -0,0 +1,140 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppRoleCredentials(t *testing.T) {
+	roles := []map[string]interface{}{
+		{"name": "ci", "policies": "ci", "credentials": map[string]interface{}{
+			"k8s_secret":      map[string]interface{}{"name": "ci-approle"},
+			"rotation_period": "12h",
+		}},
+		{"name": "batch", "credentials": map[string]interface{}{"wrap_ttl": "5 minutes"}},
+		{"name": "web"},
+	}
+
+	stripped := withoutAppRoleCredentials(roles)
+	if _, ok := stripped[0]["credentials"]; ok || stripped[0]["policies"] != "ci" {
+		t.Errorf("expected the role without its credentials, got %#v", stripped[0])
+	}
+	if _, ok := roles[0]["credentials"]; !ok {
+		t.Error("expected the original role to keep its credentials")
+	}
+
+	credentials, err := appRoleCredentials(roles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.K8sSecret == nil || credentials.K8sSecret.Name != "ci-approle" || credentials.RotationPeriod != "12h" {
+		t.Errorf("unexpected credentials: %#v", credentials)
+	}
+
+	config := ExternalConfig{Auth: []AuthMethod{{Type: "approle", Roles: roles}}}
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"auth[0].roles[1].credentials.k8s_secret (or kv) missing",
+		"auth[0].roles[1].credentials.wrap_ttl is invalid",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error '%s' in: %s", expected, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "roles[0]") || strings.Contains(err.Error(), "roles[2]") {
+		t.Errorf("expected roles[0] and roles[2] to be valid: %s", err.Error())
+	}
+}
+
+// fakeAppRole handles the role ID, secret ID and wrapping endpoints of the ci approle role
+func fakeAppRole(f *fakeVault) {
+	secretIDs := 0
+	f.handle("GET", "auth/approle/role/ci/role-id", func(map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"role_id": "role"}}
+	})
+	f.handle("PUT", "auth/approle/role/ci/secret-id", func(map[string]interface{}) (int, interface{}) {
+		secretIDs++
+		return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"secret_id":          fmt.Sprint("secret-", secretIDs),
+			"secret_id_accessor": fmt.Sprint("accessor-", secretIDs),
+		}}
+	})
+	f.handle("PUT", "sys/wrapping/wrap", func(body map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"wrap_info": map[string]interface{}{
+			"token": fmt.Sprint("wrapped-", body["secret_id"]),
+			"ttl":   300,
+		}}
+	})
+}
+
+func TestDeliverAppRoleCredential(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	fakeAppRole(f)
+	store := newMemoryKV()
+	v := f.vault(store)
+
+	credentials := &AppRoleCredentials{KV: "ci"}
+	for i := 0; i < 2; i++ {
+		if err := v.deliverAppRoleCredential("approle", "ci", credentials); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.count("PUT", "auth/approle/role/ci/secret-id") != 1 {
+		t.Errorf("expected a single secret ID without a rotation period, got %d", f.count("PUT", "auth/approle/role/ci/secret-id"))
+	}
+	if string(store.data["ci-role-id"]) != "role" || string(store.data["ci-secret-id"]) != "secret-1" {
+		t.Errorf("expected the credentials in the key store, got %v", store.data)
+	}
+
+	// a new wrapped secret ID is delivered once the wrapping token of the last one has expired
+	credentials.WrapTTL = "5m"
+	store.data["vault-approle-approle-ci"] = []byte(`{"secret_id_accessor": "accessor-1", "issued": "2020-01-01T00:00:00Z"}`)
+	for i := 0; i < 2; i++ {
+		if err := v.deliverAppRoleCredential("approle", "ci", credentials); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.count("PUT", "auth/approle/role/ci/secret-id") != 1 {
+		t.Errorf("expected no new secret ID before the rotation, got %d", f.count("PUT", "auth/approle/role/ci/secret-id"))
+	}
+
+	record, _ := v.appRoleSecretID("vault-approle-approle-ci")
+	record.WrapExpires = time.Now().Add(-time.Minute)
+	store.data["vault-approle-approle-ci"], _ = json.Marshal(record)
+	if err := v.deliverAppRoleCredential("approle", "ci", credentials); err != nil {
+		t.Fatal(err)
+	}
+	if string(store.data["ci-secret-id-wrapping-token"]) != "wrapped-secret-2" {
+		t.Errorf("expected a new wrapping token, got %v", store.data)
+	}
+	if f.count("PUT", "auth/approle/role/ci/secret-id-accessor/destroy") != 1 || f.get("auth/approle/role/ci/secret-id-accessor/destroy")["secret_id_accessor"] != "accessor-1" {
+		t.Error("expected the previous secret ID to be destroyed")
+	}
+	record, _ = v.appRoleSecretID("vault-approle-approle-ci")
+	if record.Accessor != "accessor-2" || record.WrapExpires.Sub(record.Issued) != 5*time.Minute {
+		t.Errorf("expected the wrap expiry to be recorded, got %+v", record)
+	}
+}
+
+func TestDeliverAppRoleCredentialDiscardingKeyStore(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	fakeAppRole(f)
+	v := &vault{keyStore: discardKV{}, cl: f.client()}
+
+	err := v.deliverAppRoleCredential("approle", "ci", &AppRoleCredentials{KV: "ci"})
+	if err == nil || !strings.Contains(err.Error(), "doesn't keep the records") {
+		t.Errorf("expected the key store to be refused, got %v", err)
+	}
+	if f.count("PUT", "auth/approle/role/ci/secret-id") != 0 {
+		t.Error("expected no secret ID to be generated")
+	}
+}
@@ -0,0 +1,82 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// configureAuditDevices enables the missing audit devices, and re-creates the ones
+// whose settings differ, since audit devices can't be tuned
+func (v *vault) configureAuditDevices(auditDevices []AuditDevice) error {
+	existingAudits, err := v.cl.Sys().ListAudit()
+	if err != nil {
+		return fmt.Errorf("error listing audit devices in vault: %s", err.Error())
+	}
+
+	for _, auditDevice := range auditDevices {
+		path := auditDevice.MountPath()
+		options := api.EnableAuditOptions{
+			Type:        auditDevice.Type,
+			Description: auditDevice.Description,
+			Options:     cast.ToStringMapString(auditDevice.Options),
+			Local:       auditDevice.Local,
+		}
+
+		if existingAudit, ok := existingAudits[path+"/"]; ok {
+			fields := changedAuditFields(&options, existingAudit)
+			if len(fields) == 0 {
+				logrus.Debugf("%s audit device is already enabled in vault", path)
+				continue
+			}
+
+			logrus.Infof("re-creating %s audit device, its %s changed...", path, strings.Join(fields, ", "))
+			if v.plan != nil {
+				v.plan.add(ActionUpdate, "sys/audit/"+path, fields...)
+				continue
+			}
+
+			err = v.disableAudit(path)
+			if err != nil {
+				return fmt.Errorf("error disabling %s audit device in vault: %s", path, err.Error())
+			}
+		}
+
+		err = v.enableAudit(path, &options)
+		if err != nil {
+			return fmt.Errorf("error enabling %s audit device in vault: %s", path, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// changedAuditFields returns the sorted names of the settings of an audit device which differ
+func changedAuditFields(desired *api.EnableAuditOptions, actual *api.Audit) []string {
+	fields := []string{}
+	if desired.Type != actual.Type {
+		fields = append(fields, "type")
+	}
+	if desired.Description != actual.Description {
+		fields = append(fields, "description")
+	}
+	if desired.Local != actual.Local {
+		fields = append(fields, "local")
+	}
+	for key, value := range desired.Options {
+		if actualValue, ok := actual.Options[key]; !ok || actualValue != value {
+			fields = append(fields, "options."+key)
+		}
+	}
+	for key := range actual.Options {
+		if _, ok := desired.Options[key]; !ok {
+			fields = append(fields, "options."+key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
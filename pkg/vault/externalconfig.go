@@ -0,0 +1,751 @@
+package vault
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+)
+
+// ExternalConfig is the configuration Configure applies to Vault, read from the
+// vault-config.yml file or from the externalConfig field of the Vault custom resource
+type ExternalConfig struct {
+	Plugins              []Plugin                 `json:"plugins,omitempty" mapstructure:"plugins"`
+	Policies             []Policy                 `json:"policies,omitempty" mapstructure:"policies"`
+	Auth                 []AuthMethod             `json:"auth,omitempty" mapstructure:"auth"`
+	Secrets              []SecretEngine           `json:"secrets,omitempty" mapstructure:"secrets"`
+	Audit                []AuditDevice            `json:"audit,omitempty" mapstructure:"audit"`
+	Identity             *Identity                `json:"identity,omitempty" mapstructure:"identity"`
+	Sys                  *SysConfig               `json:"sys,omitempty" mapstructure:"sys"`
+	TokenRoles           []map[string]interface{} `json:"tokenRoles,omitempty" mapstructure:"tokenRoles"`
+	Tokens               []Token                  `json:"tokens,omitempty" mapstructure:"tokens"`
+	StartupSecrets       []StartupSecret          `json:"startupSecrets,omitempty" mapstructure:"startupSecrets"`
+	Outputs              []Output                 `json:"outputs,omitempty" mapstructure:"outputs"`
+	PurgeUnmanagedConfig *PurgeConfig             `json:"purgeUnmanagedConfig,omitempty" mapstructure:"purgeUnmanagedConfig"`
+}
+
+// Plugin is a plugin registered in the plugin catalog of Vault, so that auth methods and secret engines
+// can be mounted with its name as plugin_name. If Directory (the plugin directory of Vault) is set, the
+// SHA256 checksum of the command in it is checked against SHA256, or used instead if SHA256 is empty
+type Plugin struct {
+	Name      string   `json:"name" mapstructure:"name"`
+	Command   string   `json:"command" mapstructure:"command"`
+	Args      []string `json:"args,omitempty" mapstructure:"args"`
+	Env       []string `json:"env,omitempty" mapstructure:"env"`
+	SHA256    string   `json:"sha256,omitempty" mapstructure:"sha256"`
+	Directory string   `json:"directory,omitempty" mapstructure:"directory"`
+}
+
+// Policy is a named ACL policy in HCL format
+type Policy struct {
+	Name  string `json:"name" mapstructure:"name"`
+	Rules string `json:"rules" mapstructure:"rules"`
+}
+
+// AuthMethod is an auth method mounted to Path (defaults to Type), the config is written
+// to auth/<path>/config and the roles to auth/<path>/role/<name> as they are
+type AuthMethod struct {
+	Type        string `json:"type" mapstructure:"type"`
+	Path        string `json:"path,omitempty" mapstructure:"path"`
+	Description string `json:"description,omitempty" mapstructure:"description"`
+	Local       bool   `json:"local,omitempty" mapstructure:"local"`
+	SealWrap    bool   `json:"seal_wrap,omitempty" mapstructure:"seal_wrap"`
+	MountTuning `mapstructure:",squash"`
+
+	Config map[string]interface{}   `json:"config,omitempty" mapstructure:"config"`
+	Roles  []map[string]interface{} `json:"roles,omitempty" mapstructure:"roles"`
+	// Map holds the team and user policy mappings of the github auth method
+	Map map[string]map[string]interface{} `json:"map,omitempty" mapstructure:"map"`
+	// Sections holds the other keys of the auth method (e.g. groups or users), the
+	// items of a section are written to auth/<path>/<section>/<name> as they are
+	Sections map[string][]map[string]interface{} `json:"-" mapstructure:"sections"`
+}
+
+// authMethodFields are the keys of an auth method which are not sections
+var authMethodFields = structFields(reflect.TypeOf(AuthMethod{}))
+
+// MountPath returns the path the auth method is mounted to
+func (a *AuthMethod) MountPath() string {
+	if a.Path != "" {
+		return a.Path
+	}
+	return a.Type
+}
+
+// AppRoleCredentials is where the role ID and a secret ID of an approle role (given as its credentials key)
+// are delivered to: a Kubernetes Secret and/or keys of the bank-vaults key store. The secret ID is response
+// wrapped if WrapTTL is set, a new one is delivered after RotationPeriod or once the wrapping token expires
+// and the previous one is destroyed
+type AppRoleCredentials struct {
+	K8sSecret      *KubernetesSecretRef `json:"k8s_secret,omitempty" mapstructure:"k8s_secret"`
+	KV             string               `json:"kv,omitempty" mapstructure:"kv"`
+	WrapTTL        string               `json:"wrap_ttl,omitempty" mapstructure:"wrap_ttl"`
+	RotationPeriod string               `json:"rotation_period,omitempty" mapstructure:"rotation_period"`
+}
+
+// KubernetesSecretRef is a Kubernetes Secret, the namespace defaults to the one bank-vaults runs in
+type KubernetesSecretRef struct {
+	Namespace string `json:"namespace,omitempty" mapstructure:"namespace"`
+	Name      string `json:"name" mapstructure:"name"`
+}
+
+// appRoleCredentialsKey is the key of the credentials of an approle role
+const appRoleCredentialsKey = "credentials"
+
+// appRoleCredentials decodes the credentials of an approle role, it returns nil if the role has none
+func appRoleCredentials(role map[string]interface{}) (*AppRoleCredentials, error) {
+	value, ok := role[appRoleCredentialsKey]
+	if !ok {
+		return nil, nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a map")
+	}
+	credentials := AppRoleCredentials{}
+	err := decodeConfig(fields, &credentials, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &credentials, nil
+}
+
+// SecretEngine is a secret engine mounted to Path (defaults to Type), the items of the
+// configuration are written to <path>/<configuration key>/<item name> as they are, the
+// data of the paths to <path>/<relative path> (e.g. ssh/config/ca or transit/keys/x/config)
+type SecretEngine struct {
+	Type        string `json:"type" mapstructure:"type"`
+	Path        string `json:"path,omitempty" mapstructure:"path"`
+	Description string `json:"description,omitempty" mapstructure:"description"`
+	PluginName  string `json:"plugin_name,omitempty" mapstructure:"plugin_name"`
+	Local       bool   `json:"local,omitempty" mapstructure:"local"`
+	SealWrap    bool   `json:"seal_wrap,omitempty" mapstructure:"seal_wrap"`
+	MountTuning `mapstructure:",squash"`
+
+	// PreviousPath is the path the secret engine is moved from (with its data and leases), if it is mounted there
+	PreviousPath string `json:"previous_path,omitempty" mapstructure:"previous_path"`
+	// RotateRoot rotates the root credentials of the database connections and the aws root config (written
+	// by the configuration or the paths) once they are written, so that only Vault knows them, they are
+	// rotated again only if the config changes
+	RotateRoot bool `json:"rotate_root,omitempty" mapstructure:"rotate_root"`
+
+	Options       map[string]interface{}              `json:"options,omitempty" mapstructure:"options"`
+	Configuration map[string][]map[string]interface{} `json:"configuration,omitempty" mapstructure:"configuration"`
+	Paths         []SecretEnginePath                  `json:"paths,omitempty" mapstructure:"paths"`
+	PKI           *PKIConfig                          `json:"pki,omitempty" mapstructure:"pki"`
+}
+
+// SecretEnginePath is data written to a path relative to the mount of a secret engine. In update
+// mode (the default) it is written every time, in create mode only if the path can't be read yet,
+// in replace mode the path is deleted before writing it if it has changed, for configs which
+// can't be overwritten (e.g. the CA of the ssh secret engine)
+type SecretEnginePath struct {
+	Path string                 `json:"path" mapstructure:"path"`
+	Mode string                 `json:"mode,omitempty" mapstructure:"mode"`
+	Data map[string]interface{} `json:"data,omitempty" mapstructure:"data"`
+}
+
+// The modes of writing the paths of secret engines
+const (
+	WriteModeCreate  = "create"
+	WriteModeUpdate  = "update"
+	WriteModeReplace = "replace"
+)
+
+// MountPath returns the path the secret engine is mounted to
+func (s *SecretEngine) MountPath() string {
+	if s.Path != "" {
+		return s.Path
+	}
+	return s.Type
+}
+
+// PKIConfig bootstraps a pki secret engine: its root CA is generated (or imported if root has a pem_bundle)
+// or its intermediate CA is signed by the pki secret engine mounted to intermediate.signed_by, once.
+// The URLs, CRL config and roles are written to <path>/config/urls, <path>/config/crl and <path>/roles/<name>
+type PKIConfig struct {
+	Root         map[string]interface{}   `json:"root,omitempty" mapstructure:"root"`
+	Intermediate map[string]interface{}   `json:"intermediate,omitempty" mapstructure:"intermediate"`
+	URLs         map[string]interface{}   `json:"urls,omitempty" mapstructure:"urls"`
+	CRL          map[string]interface{}   `json:"crl,omitempty" mapstructure:"crl"`
+	Roles        []map[string]interface{} `json:"roles,omitempty" mapstructure:"roles"`
+	ExportCA     *PKIExport               `json:"export_ca,omitempty" mapstructure:"export_ca"`
+}
+
+// PKIExport is where the CA certificate of a pki secret engine is exported to,
+// a file and/or a key of the bank-vaults key store
+type PKIExport struct {
+	File string `json:"file,omitempty" mapstructure:"file"`
+	KV   string `json:"kv,omitempty" mapstructure:"kv"`
+}
+
+// AuditDevice is an audit device (file, syslog or socket) enabled at Path (defaults to Type)
+type AuditDevice struct {
+	Type        string                 `json:"type" mapstructure:"type"`
+	Path        string                 `json:"path,omitempty" mapstructure:"path"`
+	Description string                 `json:"description,omitempty" mapstructure:"description"`
+	Local       bool                   `json:"local,omitempty" mapstructure:"local"`
+	Options     map[string]interface{} `json:"options,omitempty" mapstructure:"options"`
+}
+
+// MountPath returns the path the audit device is enabled at
+func (a *AuditDevice) MountPath() string {
+	if a.Path != "" {
+		return a.Path
+	}
+	return a.Type
+}
+
+// Identity holds the identity entities and groups, which are looked up by their names
+type Identity struct {
+	Entities []IdentityEntity `json:"entities,omitempty" mapstructure:"entities"`
+	Groups   []IdentityGroup  `json:"groups,omitempty" mapstructure:"groups"`
+}
+
+// IdentityEntity is an identity entity with its aliases
+type IdentityEntity struct {
+	Name     string            `json:"name" mapstructure:"name"`
+	Policies []string          `json:"policies,omitempty" mapstructure:"policies"`
+	Metadata map[string]string `json:"metadata,omitempty" mapstructure:"metadata"`
+	Aliases  []IdentityAlias   `json:"aliases,omitempty" mapstructure:"aliases"`
+}
+
+// IdentityGroup is an internal (default) or external identity group, the member groups and
+// entities are referenced by name, an external group can have an alias of an auth method
+type IdentityGroup struct {
+	Name           string            `json:"name" mapstructure:"name"`
+	Type           string            `json:"type,omitempty" mapstructure:"type"`
+	Policies       []string          `json:"policies,omitempty" mapstructure:"policies"`
+	Metadata       map[string]string `json:"metadata,omitempty" mapstructure:"metadata"`
+	MemberGroups   []string          `json:"member_groups,omitempty" mapstructure:"member_groups"`
+	MemberEntities []string          `json:"member_entities,omitempty" mapstructure:"member_entities"`
+	Alias          *IdentityAlias    `json:"alias,omitempty" mapstructure:"alias"`
+}
+
+// IdentityAlias is the name of an entity or group in the auth method mounted to Path,
+// e.g. the name of an LDAP group
+type IdentityAlias struct {
+	Name string `json:"name" mapstructure:"name"`
+	Path string `json:"path" mapstructure:"path"`
+}
+
+// StartupSecret is a secret written to Path of a KV (version 1 or 2) secret engine, e.g. secret/app/db,
+// it is only created if it doesn't exist unless Overwrite is set. CAS is the check-and-set version
+// of the overwrites of a KV version 2 secret. The values of Data are literals, or read from one of
+// the sources in startupSecretSources, e.g. password: {env: DB_PASSWORD}
+type StartupSecret struct {
+	Path      string                 `json:"path" mapstructure:"path"`
+	Overwrite bool                   `json:"overwrite,omitempty" mapstructure:"overwrite"`
+	CAS       *int                   `json:"cas,omitempty" mapstructure:"cas"`
+	Data      map[string]interface{} `json:"data" mapstructure:"data"`
+}
+
+// Token is a token created once with a token role (or as an orphan) and delivered to a file, a Kubernetes
+// Secret (token and accessor keys) and/or the bank-vaults key store (<kv>-token and <kv>-accessor keys).
+// It is created again if its accessor recorded in the key store is no longer valid (e.g. it has expired).
+type Token struct {
+	Name            string            `json:"name" mapstructure:"name"`
+	Role            string            `json:"role,omitempty" mapstructure:"role"`
+	Orphan          bool              `json:"orphan,omitempty" mapstructure:"orphan"`
+	ID              string            `json:"id,omitempty" mapstructure:"id"`
+	Policies        []string          `json:"policies,omitempty" mapstructure:"policies"`
+	NoDefaultPolicy bool              `json:"no_default_policy,omitempty" mapstructure:"no_default_policy"`
+	Metadata        map[string]string `json:"meta,omitempty" mapstructure:"meta"`
+	DisplayName     string            `json:"display_name,omitempty" mapstructure:"display_name"`
+	TTL             string            `json:"ttl,omitempty" mapstructure:"ttl"`
+	ExplicitMaxTTL  string            `json:"explicit_max_ttl,omitempty" mapstructure:"explicit_max_ttl"`
+	Period          string            `json:"period,omitempty" mapstructure:"period"`
+
+	File      string               `json:"file,omitempty" mapstructure:"file"`
+	K8sSecret *KubernetesSecretRef `json:"k8s_secret,omitempty" mapstructure:"k8s_secret"`
+	KV        string               `json:"kv,omitempty" mapstructure:"kv"`
+}
+
+// Output is a set of fields read from a Vault path after Configure (e.g. the public_key of
+// ssh-client-signer/config/ca), which are written to a file (if there is a single field),
+// a Kubernetes ConfigMap or Secret and/or the bank-vaults key store whenever they change
+type Output struct {
+	Path      string               `json:"path" mapstructure:"path"`
+	Fields    []string             `json:"fields" mapstructure:"fields"`
+	File      string               `json:"file,omitempty" mapstructure:"file"`
+	ConfigMap *KubernetesSecretRef `json:"configmap,omitempty" mapstructure:"configmap"`
+	K8sSecret *KubernetesSecretRef `json:"k8s_secret,omitempty" mapstructure:"k8s_secret"`
+	// KV is the prefix of the key store keys, e.g. <kv>-public-key
+	KV string `json:"kv,omitempty" mapstructure:"kv"`
+}
+
+// SysConfig holds the cluster-level settings of Vault, they are applied if they drift from the configuration
+type SysConfig struct {
+	CORS *CORSConfig `json:"cors,omitempty" mapstructure:"cors"`
+	// UIHeaders are the custom response headers of the UI, with their values
+	UIHeaders           map[string][]string  `json:"ui_headers,omitempty" mapstructure:"ui_headers"`
+	AuditRequestHeaders []AuditRequestHeader `json:"audit_request_headers,omitempty" mapstructure:"audit_request_headers"`
+	// Mounts holds the tuning of mounts which are not configured in the secrets section,
+	// e.g. the default and max lease TTLs of sys, cubbyhole or auth/token
+	Mounts map[string]MountTuning `json:"mounts,omitempty" mapstructure:"mounts"`
+}
+
+// CORSConfig is the CORS configuration of Vault, it is deleted from Vault if it isn't enabled
+type CORSConfig struct {
+	Enabled        bool     `json:"enabled" mapstructure:"enabled"`
+	AllowedOrigins []string `json:"allowed_origins,omitempty" mapstructure:"allowed_origins"`
+	AllowedHeaders []string `json:"allowed_headers,omitempty" mapstructure:"allowed_headers"`
+}
+
+// AuditRequestHeader is a request header logged by the audit devices, HMAC-ed if HMAC is set
+type AuditRequestHeader struct {
+	Name string `json:"name" mapstructure:"name"`
+	HMAC bool   `json:"hmac,omitempty" mapstructure:"hmac"`
+}
+
+// MountTuning holds the settings of auth methods and secret engines which are set when
+// mounting them, and tuned later on if they change
+type MountTuning struct {
+	DefaultLeaseTTL           string   `json:"default_lease_ttl,omitempty" mapstructure:"default_lease_ttl"`
+	MaxLeaseTTL               string   `json:"max_lease_ttl,omitempty" mapstructure:"max_lease_ttl"`
+	ListingVisibility         string   `json:"listing_visibility,omitempty" mapstructure:"listing_visibility"`
+	AuditNonHMACRequestKeys   []string `json:"audit_non_hmac_request_keys,omitempty" mapstructure:"audit_non_hmac_request_keys"`
+	PassthroughRequestHeaders []string `json:"passthrough_request_headers,omitempty" mapstructure:"passthrough_request_headers"`
+}
+
+// PurgeConfig holds the settings of the managed mode of Configure, in which the
+// auth methods, policies and secret engines not present in the config are removed
+type PurgeConfig struct {
+	Enabled bool         `json:"enabled" mapstructure:"enabled"`
+	Exclude PurgeExclude `json:"exclude,omitempty" mapstructure:"exclude"`
+}
+
+// PurgeExclude lists the auth method paths, policy names and secret engine paths
+// which are left in Vault by the managed mode, even if they are not in the config
+type PurgeExclude struct {
+	Auth     []string `json:"auth,omitempty" mapstructure:"auth"`
+	Policies []string `json:"policies,omitempty" mapstructure:"policies"`
+	Secrets  []string `json:"secrets,omitempty" mapstructure:"secrets"`
+	Audit    []string `json:"audit,omitempty" mapstructure:"audit"`
+}
+
+// ParseExternalConfig decodes and validates the configuration from its generic form
+// (e.g. viper.AllSettings()), it returns the unknown keys of the configuration as well
+func ParseExternalConfig(settings map[string]interface{}) (*ExternalConfig, []string, error) {
+	config := ExternalConfig{}
+	metadata := mapstructure.Metadata{}
+
+	err := decodeConfig(settings, &config, &metadata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding vault configuration: %s", err.Error())
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid vault configuration: %s", err.Error())
+	}
+
+	sort.Strings(metadata.Unused)
+	return &config, metadata.Unused, nil
+}
+
+func decodeConfig(input map[string]interface{}, result interface{}, metadata *mapstructure.Metadata) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       authMethodSectionsHook,
+		WeaklyTypedInput: true,
+		Metadata:         metadata,
+		Result:           result,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(normalizeValue(input))
+}
+
+// authMethodSectionsHook collects the keys of the auth methods which are not fields into Sections
+func authMethodSectionsHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	fields, ok := data.(map[string]interface{})
+	if !ok || to != reflect.TypeOf(AuthMethod{}) {
+		return data, nil
+	}
+
+	authMethod := map[string]interface{}{}
+	sections := map[string]interface{}{}
+	for key, value := range fields {
+		if authMethodFields[strings.ToLower(key)] {
+			authMethod[key] = value
+		} else {
+			sections[key] = value
+		}
+	}
+	if len(sections) > 0 {
+		authMethod["sections"] = sections
+	}
+	return authMethod, nil
+}
+
+// structFields returns the lower case mapstructure keys of the fields of a struct type
+func structFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("mapstructure"), ",")
+		if len(tag) > 1 && tag[1] == "squash" {
+			for name := range structFields(t.Field(i).Type) {
+				fields[name] = true
+			}
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields[strings.ToLower(name)] = true
+	}
+	return fields
+}
+
+// Validate checks the configuration, the errors point to the invalid fields, e.g. auth[2].roles[0].name
+func (c *ExternalConfig) Validate() error {
+	var result *multierror.Error
+	missing := func(format string, a ...interface{}) {
+		result = multierror.Append(result, fmt.Errorf(format+" missing", a...))
+	}
+	duplicate := func(format string, a ...interface{}) {
+		result = multierror.Append(result, fmt.Errorf(format+" is a duplicate", a...))
+	}
+
+	plugins := map[string]bool{}
+	for i, plugin := range c.Plugins {
+		if plugin.Name == "" {
+			missing("plugins[%d].name", i)
+		} else if plugins[plugin.Name] {
+			duplicate("plugins[%d].name", i)
+		}
+		plugins[plugin.Name] = true
+		if plugin.Command == "" {
+			missing("plugins[%d].command", i)
+		}
+		if plugin.SHA256 == "" && plugin.Directory == "" {
+			missing("plugins[%d].sha256 (or directory)", i)
+		}
+	}
+
+	policies := map[string]bool{}
+	for i, policy := range c.Policies {
+		if policy.Name == "" {
+			missing("policies[%d].name", i)
+		} else if policies[policy.Name] {
+			duplicate("policies[%d].name", i)
+		}
+		policies[policy.Name] = true
+		if policy.Rules == "" {
+			missing("policies[%d].rules", i)
+		} else if _, err := hcl.ParseString(policy.Rules); err != nil {
+			result = multierror.Append(result, fmt.Errorf("policies[%d].rules is invalid HCL: %s", i, err.Error()))
+		}
+	}
+
+	authPaths := map[string]bool{}
+	for i, authMethod := range c.Auth {
+		if authMethod.Type == "" {
+			missing("auth[%d].type", i)
+		} else if authPaths[authMethod.MountPath()] {
+			duplicate("auth[%d].path", i)
+		}
+		authPaths[authMethod.MountPath()] = true
+		for j, role := range authMethod.Roles {
+			if role["name"] == nil || role["name"] == "" {
+				missing("auth[%d].roles[%d].name", i, j)
+			}
+			if authMethod.Type != "approle" {
+				continue
+			}
+			credentials, err := appRoleCredentials(role)
+			if err != nil {
+				result = multierror.Append(result, fmt.Errorf("auth[%d].roles[%d].credentials is invalid: %s", i, j, err.Error()))
+			} else if credentials != nil {
+				if credentials.K8sSecret == nil && credentials.KV == "" {
+					missing("auth[%d].roles[%d].credentials.k8s_secret (or kv)", i, j)
+				}
+				if credentials.K8sSecret != nil && credentials.K8sSecret.Name == "" {
+					missing("auth[%d].roles[%d].credentials.k8s_secret.name", i, j)
+				}
+				if _, err := time.ParseDuration(credentials.WrapTTL); credentials.WrapTTL != "" && err != nil {
+					result = multierror.Append(result, fmt.Errorf("auth[%d].roles[%d].credentials.wrap_ttl is invalid: %s", i, j, err.Error()))
+				}
+				if _, err := time.ParseDuration(credentials.RotationPeriod); credentials.RotationPeriod != "" && err != nil {
+					result = multierror.Append(result, fmt.Errorf("auth[%d].roles[%d].credentials.rotation_period is invalid: %s", i, j, err.Error()))
+				}
+			}
+		}
+		for _, section := range sortedKeys(authMethod.Sections) {
+			for j, item := range authMethod.Sections[section] {
+				if item["name"] == nil || item["name"] == "" {
+					missing("auth[%d].%s[%d].name", i, section, j)
+				}
+			}
+		}
+	}
+
+	secretPaths := map[string]bool{}
+	for i, secretEngine := range c.Secrets {
+		if secretEngine.Type == "" {
+			missing("secrets[%d].type", i)
+		} else if secretPaths[secretEngine.MountPath()] {
+			duplicate("secrets[%d].path", i)
+		}
+		secretPaths[secretEngine.MountPath()] = true
+		if secretEngine.RotateRoot && secretEngine.Type != "database" && secretEngine.Type != "aws" {
+			result = multierror.Append(result, fmt.Errorf("secrets[%d].rotate_root is only supported by database and aws secret engines", i))
+		}
+		if previousPath := strings.Trim(secretEngine.PreviousPath, "/"); previousPath != "" && previousPath == strings.Trim(secretEngine.MountPath(), "/") {
+			result = multierror.Append(result, fmt.Errorf("secrets[%d].previous_path must differ from the path", i))
+		}
+		for _, configOption := range sortedKeys(secretEngine.Configuration) {
+			for j, item := range secretEngine.Configuration[configOption] {
+				if item["name"] == nil || item["name"] == "" {
+					missing("secrets[%d].configuration.%s[%d].name", i, configOption, j)
+				}
+			}
+		}
+		enginePaths := map[string]bool{}
+		for j, enginePath := range secretEngine.Paths {
+			relativePath := strings.Trim(enginePath.Path, "/")
+			if relativePath == "" {
+				missing("secrets[%d].paths[%d].path", i, j)
+			} else if enginePaths[relativePath] {
+				duplicate("secrets[%d].paths[%d].path", i, j)
+			} else if strings.Contains("/"+relativePath+"/", "/../") {
+				result = multierror.Append(result, fmt.Errorf("secrets[%d].paths[%d].path must be relative to the mount", i, j))
+			}
+			enginePaths[relativePath] = true
+			switch enginePath.Mode {
+			case "", WriteModeCreate, WriteModeUpdate, WriteModeReplace:
+			default:
+				result = multierror.Append(result, fmt.Errorf("secrets[%d].paths[%d].mode must be %s, %s or %s", i, j, WriteModeCreate, WriteModeUpdate, WriteModeReplace))
+			}
+		}
+		if pki := secretEngine.PKI; pki != nil {
+			if secretEngine.Type != "pki" {
+				result = multierror.Append(result, fmt.Errorf("secrets[%d].pki is only allowed for pki secret engines", i))
+			}
+			if pki.Root != nil && pki.Intermediate != nil {
+				result = multierror.Append(result, fmt.Errorf("secrets[%d].pki can't have both a root and an intermediate CA", i))
+			}
+			if pki.Intermediate != nil && (pki.Intermediate["signed_by"] == nil || pki.Intermediate["signed_by"] == "") {
+				missing("secrets[%d].pki.intermediate.signed_by", i)
+			}
+			for j, role := range pki.Roles {
+				if role["name"] == nil || role["name"] == "" {
+					missing("secrets[%d].pki.roles[%d].name", i, j)
+				}
+			}
+		}
+	}
+
+	auditPaths := map[string]bool{}
+	for i, auditDevice := range c.Audit {
+		if auditDevice.Type == "" {
+			missing("audit[%d].type", i)
+		} else if auditPaths[auditDevice.MountPath()] {
+			duplicate("audit[%d].path", i)
+		}
+		auditPaths[auditDevice.MountPath()] = true
+	}
+
+	if c.Identity != nil {
+		entities := map[string]bool{}
+		for i, entity := range c.Identity.Entities {
+			if entity.Name == "" {
+				missing("identity.entities[%d].name", i)
+			} else if entities[entity.Name] {
+				duplicate("identity.entities[%d].name", i)
+			}
+			entities[entity.Name] = true
+			for j, alias := range entity.Aliases {
+				if alias.Name == "" {
+					missing("identity.entities[%d].aliases[%d].name", i, j)
+				}
+				if alias.Path == "" {
+					missing("identity.entities[%d].aliases[%d].path", i, j)
+				}
+			}
+		}
+
+		groups := map[string]bool{}
+		for i, group := range c.Identity.Groups {
+			if group.Name == "" {
+				missing("identity.groups[%d].name", i)
+			} else if groups[group.Name] {
+				duplicate("identity.groups[%d].name", i)
+			}
+			groups[group.Name] = true
+			if group.Type != "" && group.Type != "internal" && group.Type != "external" {
+				result = multierror.Append(result, fmt.Errorf("identity.groups[%d].type must be internal or external", i))
+			}
+			if group.Alias != nil {
+				if group.Type != "external" {
+					result = multierror.Append(result, fmt.Errorf("identity.groups[%d].alias is only allowed for external groups", i))
+				}
+				if group.Alias.Name == "" {
+					missing("identity.groups[%d].alias.name", i)
+				}
+				if group.Alias.Path == "" {
+					missing("identity.groups[%d].alias.path", i)
+				}
+			}
+		}
+	}
+
+	startupSecretPaths := map[string]bool{}
+	for i, startupSecret := range c.StartupSecrets {
+		if startupSecret.Path == "" {
+			missing("startupSecrets[%d].path", i)
+		} else if startupSecretPaths[startupSecret.Path] {
+			duplicate("startupSecrets[%d].path", i)
+		}
+		startupSecretPaths[startupSecret.Path] = true
+		if len(startupSecret.Data) == 0 {
+			missing("startupSecrets[%d].data", i)
+		}
+		if startupSecret.CAS != nil && !startupSecret.Overwrite {
+			result = multierror.Append(result, fmt.Errorf("startupSecrets[%d].cas is only allowed with overwrite", i))
+		}
+		keys := make([]string, 0, len(startupSecret.Data))
+		for key := range startupSecret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := validateStartupSecretValue(startupSecret.Data[key]); err != nil {
+				result = multierror.Append(result, fmt.Errorf("startupSecrets[%d].data.%s %s", i, key, err.Error()))
+			}
+		}
+	}
+
+	if c.Sys != nil {
+		if c.Sys.CORS != nil && c.Sys.CORS.Enabled && len(c.Sys.CORS.AllowedOrigins) == 0 {
+			missing("sys.cors.allowed_origins")
+		}
+		for name, values := range c.Sys.UIHeaders {
+			if len(values) == 0 {
+				missing("sys.ui_headers.%s values", name)
+			}
+		}
+		auditRequestHeaders := map[string]bool{}
+		for i, header := range c.Sys.AuditRequestHeaders {
+			name := strings.ToLower(header.Name)
+			if name == "" {
+				missing("sys.audit_request_headers[%d].name", i)
+			} else if auditRequestHeaders[name] {
+				duplicate("sys.audit_request_headers[%d].name", i)
+			}
+			auditRequestHeaders[name] = true
+		}
+		for path, tuning := range c.Sys.Mounts {
+			if len(mountTuneConfig("", tuning, nil)) == 0 {
+				missing("sys.mounts.%s tuning", path)
+			}
+			for _, secretEngine := range c.Secrets {
+				if strings.Trim(path, "/") == strings.Trim(secretEngine.MountPath(), "/") {
+					result = multierror.Append(result, fmt.Errorf("sys.mounts.%s is a secret engine of the configuration, tune it in the secrets section", path))
+				}
+			}
+		}
+	}
+
+	tokenRoles := map[string]bool{}
+	for i, role := range c.TokenRoles {
+		name := cast.ToString(role["name"])
+		if name == "" {
+			missing("tokenRoles[%d].name", i)
+		} else if tokenRoles[name] {
+			duplicate("tokenRoles[%d].name", i)
+		}
+		tokenRoles[name] = true
+	}
+
+	tokens := map[string]bool{}
+	for i, token := range c.Tokens {
+		if token.Name == "" {
+			missing("tokens[%d].name", i)
+		} else if tokens[token.Name] {
+			duplicate("tokens[%d].name", i)
+		}
+		tokens[token.Name] = true
+		if token.File == "" && token.K8sSecret == nil && token.KV == "" {
+			missing("tokens[%d].file (or k8s_secret, kv)", i)
+		}
+		if token.K8sSecret != nil && token.K8sSecret.Name == "" {
+			missing("tokens[%d].k8s_secret.name", i)
+		}
+		if token.Role != "" && token.Orphan {
+			result = multierror.Append(result, fmt.Errorf("tokens[%d] can't have both role and orphan, orphan tokens can be created with a role with orphan set", i))
+		}
+		for field, value := range map[string]string{"ttl": token.TTL, "explicit_max_ttl": token.ExplicitMaxTTL, "period": token.Period} {
+			if _, err := time.ParseDuration(value); value != "" && err != nil {
+				result = multierror.Append(result, fmt.Errorf("tokens[%d].%s is invalid: %s", i, field, err.Error()))
+			}
+		}
+	}
+
+	for i, output := range c.Outputs {
+		if output.Path == "" {
+			missing("outputs[%d].path", i)
+		}
+		if len(output.Fields) == 0 {
+			missing("outputs[%d].fields", i)
+		}
+		if output.File == "" && output.ConfigMap == nil && output.K8sSecret == nil && output.KV == "" {
+			missing("outputs[%d].file (or configmap, k8s_secret, kv)", i)
+		}
+		if output.File != "" && len(output.Fields) > 1 {
+			result = multierror.Append(result, fmt.Errorf("outputs[%d].file can only hold a single field", i))
+		}
+		if output.ConfigMap != nil && output.ConfigMap.Name == "" {
+			missing("outputs[%d].configmap.name", i)
+		}
+		if output.K8sSecret != nil && output.K8sSecret.Name == "" {
+			missing("outputs[%d].k8s_secret.name", i)
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func sortedKeys(m map[string][]map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeValue converts the map[interface{}]interface{} maps of the YAML parser
+// to map[string]interface{}, so that they can be decoded and sent to Vault as JSON
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalizeValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = normalizeValue(value)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, value := range v {
+			l[i] = normalizeValue(value)
+		}
+		return l
+	default:
+		return value
+	}
+}
@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestParseExternalConfig(t *testing.T) {
+	settings := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(`
+policies:
+  - name: allow_secrets
+    rules: path "secret/*" { capabilities = ["read"] }
+auth:
+  - type: kubernetes
+    roles:
+      - name: default
+        policies: allow_secrets
+  - type: github
+    max_lease_ttl: 24h
+    config:
+      organization: banzaicloud
+    map:
+      teams:
+        dev: allow_secrets
+  - type: aws
+    roles:
+      - bound_iam_principal_arn: arn:aws:iam::123456789012:role/MyRole
+secrets:
+  - type: kv
+    path: secret
+    default_lease_ttl: 1h
+    options:
+      version: 2
+  - path: pki
+    configuration:
+      roles:
+        - allowed_domains: localhost
+unknown: true
+`), &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ParseExternalConfig(settings)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"auth[2].roles[0].name missing",
+		"secrets[1].type missing",
+		"secrets[1].configuration.roles[0].name missing",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error '%s' in: %s", expected, err.Error())
+		}
+	}
+
+	settings["auth"].([]interface{})[2].(map[interface{}]interface{})["roles"] = []interface{}{}
+	settings["secrets"] = settings["secrets"].([]interface{})[:1]
+
+	config, unknownKeys, err := ParseExternalConfig(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unknownKeys) != 1 || unknownKeys[0] != "unknown" {
+		t.Errorf("expected 'unknown' as the only unknown key, got %v", unknownKeys)
+	}
+	if path := config.Auth[1].MountPath(); path != "github" {
+		t.Errorf("expected github mount path, got %s", path)
+	}
+	if version := config.Secrets[0].Options["version"]; version != 2 {
+		t.Errorf("expected version 2 option, got %#v", version)
+	}
+	if team := config.Auth[1].Map["teams"]["dev"]; team != "allow_secrets" {
+		t.Errorf("expected allow_secrets mapping, got %#v", team)
+	}
+	if ttl := config.Auth[1].MaxLeaseTTL; ttl != "24h" || len(config.Auth[1].Sections) > 0 {
+		t.Errorf("expected 24h max lease TTL and no sections, got %s and %v", ttl, config.Auth[1].Sections)
+	}
+	if ttl := config.Secrets[0].DefaultLeaseTTL; ttl != "1h" {
+		t.Errorf("expected 1h default lease TTL, got %s", ttl)
+	}
+}
+
+func TestAuthMethodSections(t *testing.T) {
+	config, _, err := ParseExternalConfig(map[string]interface{}{
+		"auth": []interface{}{
+			map[string]interface{}{
+				"type":   "ldap",
+				"path":   "corp",
+				"config": map[string]interface{}{"url": "ldap://ldap.example.com"},
+				"groups": []interface{}{map[string]interface{}{"name": "admins", "policies": "admin"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authMethod := config.Auth[0]
+	if authMethod.MountPath() != "corp" || authMethod.Config["url"] != "ldap://ldap.example.com" {
+		t.Errorf("unexpected auth method: %#v", authMethod)
+	}
+	if groups := authMethod.Sections["groups"]; len(groups) != 1 || groups[0]["name"] != "admins" {
+		t.Errorf("expected the admins group in the groups section, got %#v", authMethod.Sections)
+	}
+}
+
+func TestValidatePKI(t *testing.T) {
+	config := ExternalConfig{
+		Secrets: []SecretEngine{
+			{Type: "pki", PKI: &PKIConfig{
+				Root:         map[string]interface{}{"common_name": "example.com"},
+				Intermediate: map[string]interface{}{"common_name": "example.com Intermediate Authority"},
+				Roles:        []map[string]interface{}{{"allowed_domains": "example.com"}},
+			}},
+			{Type: "kv", PKI: &PKIConfig{}},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"secrets[0].pki can't have both a root and an intermediate CA",
+		"secrets[0].pki.intermediate.signed_by missing",
+		"secrets[0].pki.roles[0].name missing",
+		"secrets[1].pki is only allowed for pki secret engines",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error '%s' in: %s", expected, err.Error())
+		}
+	}
+}
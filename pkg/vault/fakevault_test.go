@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// fakeHandler handles a request of the fake Vault, it returns the status code and the response body
+type fakeHandler func(body map[string]interface{}) (int, interface{})
+
+// fakeVault is an in-memory Vault HTTP API for the tests, written data is stored by path and returned
+// by reads (wrapped in data), paths which need more than that can be handled by the tests themselves
+type fakeVault struct {
+	t        *testing.T
+	mu       sync.Mutex
+	server   *httptest.Server
+	data     map[string]map[string]interface{}
+	handlers map[string]fakeHandler
+	// requests are the handled requests as "<method> <path>"
+	requests []string
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	f := &fakeVault{
+		t:        t,
+		data:     map[string]map[string]interface{}{},
+		handlers: map[string]fakeHandler{},
+	}
+	f.server = httptest.NewServer(f)
+	return f
+}
+
+func (f *fakeVault) Close() {
+	f.server.Close()
+}
+
+// client returns a Vault client of the fake Vault
+func (f *fakeVault) client() *api.Client {
+	config := api.DefaultConfig()
+	config.Address = f.server.URL
+	config.MaxRetries = 0
+	cl, err := api.NewClient(config)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	cl.SetToken("test")
+	return cl
+}
+
+// vault returns a vault with a client of the fake Vault and the key store
+func (f *fakeVault) vault(keyStore *memoryKV) *vault {
+	return &vault{keyStore: keyStore, cl: f.client(), config: &Config{}}
+}
+
+// handle registers a handler for the method (GET, PUT, DELETE or LIST) and path
+func (f *fakeVault) handle(method, path string, handler fakeHandler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[method+" "+path] = handler
+}
+
+// set stores data at the path, as if it had been written
+func (f *fakeVault) set(path string, data map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[path] = data
+}
+
+// get returns the data written to the path
+func (f *fakeVault) get(path string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.data[path]
+}
+
+// count returns how many times the method was requested on the path
+func (f *fakeVault) count(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, request := range f.requests {
+		if request == method+" "+path {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	method := r.Method
+	switch {
+	case method == "POST":
+		method = "PUT"
+	case method == "LIST" || r.URL.Query().Get("list") == "true":
+		method = "LIST"
+	}
+
+	body := map[string]interface{}{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, method+" "+path)
+	handler, ok := f.handlers[method+" "+path]
+	f.mu.Unlock()
+
+	status, response := http.StatusNoContent, interface{}(nil)
+	if ok {
+		status, response = handler(body)
+	} else {
+		status, response = f.serveData(method, path, body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if response != nil {
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func (f *fakeVault) serveData(method, path string, body map[string]interface{}) (int, interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch method {
+	case "GET":
+		data, ok := f.data[path]
+		if !ok {
+			return http.StatusNotFound, map[string]interface{}{"errors": []string{}}
+		}
+		return http.StatusOK, map[string]interface{}{"data": data}
+	case "PUT":
+		f.data[path] = body
+		return http.StatusNoContent, nil
+	case "DELETE":
+		delete(f.data, path)
+		return http.StatusNoContent, nil
+	}
+	return http.StatusMethodNotAllowed, map[string]interface{}{"errors": []string{fmt.Sprintf("unsupported %s %s", method, path)}}
+}
@@ -0,0 +1,213 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// configureIdentity creates or updates the identity entities and groups (looked up by name) and their aliases,
+// the entities come first and the member groups have to precede their groups, so that they can be referenced
+func (v *vault) configureIdentity(identity *Identity) error {
+	if identity == nil {
+		return nil
+	}
+
+	accessors, err := v.authMountAccessors()
+	if err != nil {
+		return err
+	}
+
+	for _, entity := range identity.Entities {
+		err := v.configureIdentityEntity(entity, accessors)
+		if err != nil {
+			return fmt.Errorf("error configuring %s identity entity: %s", entity.Name, err.Error())
+		}
+	}
+
+	for _, group := range identity.Groups {
+		err := v.configureIdentityGroup(group, accessors)
+		if err != nil {
+			return fmt.Errorf("error configuring %s identity group: %s", group.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) configureIdentityEntity(entity IdentityEntity, accessors map[string]string) error {
+	data := map[string]interface{}{
+		"name":     entity.Name,
+		"policies": append([]string{}, entity.Policies...),
+		"metadata": stringMapOrEmpty(entity.Metadata),
+	}
+
+	id, existing, err := v.writeIdentityObject("entity", entity.Name, data)
+	if err != nil {
+		return err
+	}
+
+	existingAliases := []interface{}{}
+	if existing != nil {
+		existingAliases, _ = existing["aliases"].([]interface{})
+	}
+
+	for _, alias := range entity.Aliases {
+		err := v.writeIdentityAlias("entity-alias", id, alias, accessors, existingAliases...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) configureIdentityGroup(group IdentityGroup, accessors map[string]string) error {
+	groupType := group.Type
+	if groupType == "" {
+		groupType = "internal"
+	}
+
+	data := map[string]interface{}{
+		"name":     group.Name,
+		"type":     groupType,
+		"policies": append([]string{}, group.Policies...),
+		"metadata": stringMapOrEmpty(group.Metadata),
+	}
+
+	// external groups get their members from the auth method
+	if groupType == "internal" {
+		memberGroupIDs, err := v.identityIDs("group", group.MemberGroups)
+		if err != nil {
+			return err
+		}
+		memberEntityIDs, err := v.identityIDs("entity", group.MemberEntities)
+		if err != nil {
+			return err
+		}
+		data["member_group_ids"] = memberGroupIDs
+		data["member_entity_ids"] = memberEntityIDs
+	}
+
+	id, existing, err := v.writeIdentityObject("group", group.Name, data)
+	if err != nil {
+		return err
+	}
+
+	if group.Alias != nil {
+		existingAliases := []interface{}{}
+		if existing != nil && existing["alias"] != nil {
+			existingAliases = append(existingAliases, existing["alias"])
+		}
+		return v.writeIdentityAlias("group-alias", id, *group.Alias, accessors, existingAliases...)
+	}
+
+	return nil
+}
+
+// identityObject reads an identity entity or group by its name, it returns nil if it doesn't exist
+func (v *vault) identityObject(kind, name string) (map[string]interface{}, error) {
+	secret, err := v.cl.Logical().Read(fmt.Sprintf("identity/%s/name/%s", kind, name))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s %s: %s", kind, name, err.Error())
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+	return secret.Data, nil
+}
+
+// writeIdentityObject creates the named identity entity or group, or updates it by its ID if it exists,
+// it returns the ID and the previous state of the object (the ID is empty if it would be created in plan mode)
+func (v *vault) writeIdentityObject(kind, name string, data map[string]interface{}) (string, map[string]interface{}, error) {
+	existing, err := v.identityObject(kind, name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if existing != nil {
+		id := cast.ToString(existing["id"])
+		err = v.writeConfig(fmt.Sprintf("identity/%s/id/%s", kind, id), data)
+		return id, existing, err
+	}
+
+	err = v.writeConfig("identity/"+kind, data)
+	if err != nil || v.plan != nil {
+		return "", nil, err
+	}
+
+	created, err := v.identityObject(kind, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if created == nil {
+		return "", nil, fmt.Errorf("%s %s not found after creating it", kind, name)
+	}
+	return cast.ToString(created["id"]), nil, nil
+}
+
+// writeIdentityAlias creates the alias of an entity or group, or updates the existing alias of the same auth method
+func (v *vault) writeIdentityAlias(kind, canonicalID string, alias IdentityAlias, accessors map[string]string, existingAliases ...interface{}) error {
+	path := strings.Trim(alias.Path, "/")
+	accessor, ok := accessors[path]
+	if !ok && v.plan == nil {
+		return fmt.Errorf("auth method %s of alias %s is not enabled", path, alias.Name)
+	}
+
+	data := map[string]interface{}{
+		"name":           alias.Name,
+		"mount_accessor": accessor,
+		"canonical_id":   canonicalID,
+	}
+
+	for _, existingAlias := range existingAliases {
+		existing := cast.ToStringMap(existingAlias)
+		if accessor != "" && existing["mount_accessor"] == accessor {
+			return v.writeConfig(fmt.Sprintf("identity/%s/id/%s", kind, existing["id"]), data)
+		}
+	}
+
+	return v.writeConfig("identity/"+kind, data)
+}
+
+// identityIDs looks up the IDs of the named entities or groups
+func (v *vault) identityIDs(kind string, names []string) ([]string, error) {
+	ids := []string{}
+	for _, name := range names {
+		object, err := v.identityObject(kind, name)
+		if err != nil {
+			return nil, err
+		}
+		if object == nil {
+			// it might be created by this plan
+			if v.plan != nil {
+				continue
+			}
+			return nil, fmt.Errorf("%s %s not found", kind, name)
+		}
+		ids = append(ids, cast.ToString(object["id"]))
+	}
+	return ids, nil
+}
+
+// authMountAccessors returns the accessors of the auth methods by their paths
+func (v *vault) authMountAccessors() (map[string]string, error) {
+	auths, err := v.cl.Sys().ListAuth()
+	if err != nil {
+		return nil, fmt.Errorf("error listing auth backends vault: %s", err.Error())
+	}
+
+	accessors := map[string]string{}
+	for path, auth := range auths {
+		accessors[strings.Trim(path, "/")] = auth.Accessor
+	}
+	return accessors, nil
+}
+
+func stringMapOrEmpty(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
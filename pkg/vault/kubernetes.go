@@ -0,0 +1,271 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const serviceAccountCACertFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// The config fields of the kubernetes auth method in Vault
+const (
+	kubernetesHostField   = "kubernetes_host"
+	kubernetesCACertField = "kubernetes_ca_cert"
+	tokenReviewerJWTField = "token_reviewer_jwt"
+)
+
+// The config fields of a kubernetes auth method which are resolved by bank-vaults instead of being
+// sent to Vault, they allow configuring a Vault for external (or several) Kubernetes clusters
+const (
+	kubernetesCACertFileField = "kubernetes_ca_cert_file"
+	tokenReviewerJWTFileField = "token_reviewer_jwt_file"
+	kubeconfigField           = "kubeconfig"
+	kubeconfigContextField    = "kubeconfig_context"
+)
+
+// kubernetesAuthConfig builds the config of a kubernetes auth method: the host, CA cert and token reviewer
+// JWT can be given inline, from files or from a kubeconfig context (in this order of precedence).
+// If none of them are given, the in-cluster values of the pod bank-vaults runs in are used.
+func kubernetesAuthConfig(config map[string]interface{}) (map[string]interface{}, error) {
+	authConfig := map[string]interface{}{}
+	for key, value := range config {
+		authConfig[key] = value
+	}
+
+	if !hasAnyField(authConfig, kubernetesHostField, kubernetesCACertField, tokenReviewerJWTField,
+		kubernetesCACertFileField, tokenReviewerJWTFileField, kubeconfigField, kubeconfigContextField) {
+		return inClusterKubernetesAuthConfig(authConfig)
+	}
+
+	files := map[string]string{
+		kubernetesCACertFileField: kubernetesCACertField,
+		tokenReviewerJWTFileField: tokenReviewerJWTField,
+	}
+	for fileField, field := range files {
+		if filename, ok := authConfig[fileField]; ok {
+			content, err := ioutil.ReadFile(fmt.Sprint(filename))
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %s", fileField, err.Error())
+			}
+			setDefault(authConfig, field, string(content))
+			delete(authConfig, fileField)
+		}
+	}
+
+	if hasAnyField(authConfig, kubeconfigField, kubeconfigContextField) {
+		err := kubeconfigKubernetesAuthConfig(authConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return authConfig, nil
+}
+
+// inClusterKubernetesAuthConfig uses the service account of the pod bank-vaults runs in
+func inClusterKubernetesAuthConfig(authConfig map[string]interface{}) (map[string]interface{}, error) {
+	kubernetesCACert, err := ioutil.ReadFile(serviceAccountCACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading in-cluster CA cert, set %s outside of Kubernetes: %s", kubernetesHostField, err.Error())
+	}
+	tokenReviewerJWT, err := ioutil.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading in-cluster service account token, set %s outside of Kubernetes: %s", kubernetesHostField, err.Error())
+	}
+	authConfig[kubernetesHostField] = fmt.Sprint("https://", os.Getenv("KUBERNETES_SERVICE_HOST"))
+	authConfig[kubernetesCACertField] = string(kubernetesCACert)
+	authConfig[tokenReviewerJWTField] = string(tokenReviewerJWT)
+	return authConfig, nil
+}
+
+// kubeconfigKubernetesAuthConfig fills the fields not given inline from a kubeconfig context,
+// the kubeconfig file defaults to the standard locations (KUBECONFIG or ~/.kube/config)
+func kubeconfigKubernetesAuthConfig(authConfig map[string]interface{}) error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig, ok := authConfig[kubeconfigField]; ok {
+		loadingRules.ExplicitPath = fmt.Sprint(kubeconfig)
+	}
+	overrides := &clientcmd.ConfigOverrides{}
+	if context, ok := authConfig[kubeconfigContextField]; ok {
+		overrides.CurrentContext = fmt.Sprint(context)
+	}
+
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %s", err.Error())
+	}
+
+	caCert := restConfig.CAData
+	if len(caCert) == 0 && restConfig.CAFile != "" {
+		caCert, err = ioutil.ReadFile(restConfig.CAFile)
+		if err != nil {
+			return fmt.Errorf("error reading the CA cert of the kubeconfig: %s", err.Error())
+		}
+	}
+
+	setDefault(authConfig, kubernetesHostField, restConfig.Host)
+	setDefault(authConfig, kubernetesCACertField, string(caCert))
+	setDefault(authConfig, tokenReviewerJWTField, restConfig.BearerToken)
+
+	delete(authConfig, kubeconfigField)
+	delete(authConfig, kubeconfigContextField)
+	return nil
+}
+
+func hasAnyField(m map[string]interface{}, fields ...string) bool {
+	for _, field := range fields {
+		if _, ok := m[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// setDefault sets the field to a non-empty value, unless it is set already
+func setDefault(m map[string]interface{}, field, value string) {
+	if _, ok := m[field]; !ok && value != "" {
+		m[field] = value
+	}
+}
+
+// KubernetesClient creates a client for the cluster bank-vaults runs in, or the one in KUBECONFIG
+func KubernetesClient() (*kubernetes.Clientset, error) {
+	kubeconfig := os.Getenv(clientcmd.RecommendedConfigPathEnvVar)
+	var config *rest.Config
+	var err error
+
+	if kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating k8s config: %s", err.Error())
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating k8s client: %s", err.Error())
+	}
+	return client, nil
+}
+
+// KubernetesNamespace defaults the namespace to the one bank-vaults runs in, or "default"
+func KubernetesNamespace(namespace string) string {
+	if namespace != "" {
+		return namespace
+	}
+	if content, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(content))
+	}
+	return metav1.NamespaceDefault
+}
+
+// kubernetesSecretValue reads a key of a Kubernetes Secret
+func kubernetesSecretValue(namespace, name, key string) (string, error) {
+	client, err := KubernetesClient()
+	if err != nil {
+		return "", err
+	}
+
+	namespace = KubernetesNamespace(namespace)
+	secret, err := client.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error reading %s/%s secret: %s", namespace, name, err.Error())
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("%s/%s secret has no %s key", namespace, name, key)
+	}
+	return string(value), nil
+}
+
+// writeKubernetesSecret creates the Kubernetes Secret, or updates the given keys of it if they have changed
+func writeKubernetesSecret(namespace, name string, data map[string][]byte) error {
+	client, err := KubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	namespace = KubernetesNamespace(namespace)
+	secrets := client.CoreV1().Secrets(namespace)
+
+	secret, err := secrets.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       data,
+		}
+		_, err = secrets.Create(secret)
+	} else if err == nil {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		changed := false
+		for key, value := range data {
+			if !bytes.Equal(secret.Data[key], value) {
+				secret.Data[key] = value
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		_, err = secrets.Update(secret)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s/%s secret: %s", namespace, name, err.Error())
+	}
+	return nil
+}
+
+// writeKubernetesConfigMap creates the Kubernetes ConfigMap, or updates the given keys of it if they have changed
+func writeKubernetesConfigMap(namespace, name string, data map[string]string) error {
+	client, err := KubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	namespace = KubernetesNamespace(namespace)
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+
+	configMap, err := configMaps.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       data,
+		}
+		_, err = configMaps.Create(configMap)
+	} else if err == nil {
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		changed := false
+		for key, value := range data {
+			if configMap.Data[key] != value {
+				configMap.Data[key] = value
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		_, err = configMaps.Update(configMap)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s/%s configmap: %s", namespace, name, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKubernetesAuthConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubernetes-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caCertFile := filepath.Join(dir, "ca.crt")
+	jwtFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(caCertFile, []byte("file-ca"), 0600)
+	ioutil.WriteFile(jwtFile, []byte("file-jwt"), 0600)
+
+	config, err := kubernetesAuthConfig(map[string]interface{}{
+		"kubernetes_host":         "https://k8s-prod.example.com",
+		"kubernetes_ca_cert":      "inline-ca",
+		"kubernetes_ca_cert_file": caCertFile,
+		"token_reviewer_jwt_file": jwtFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"kubernetes_host":    "https://k8s-prod.example.com",
+		"kubernetes_ca_cert": "inline-ca",
+		"token_reviewer_jwt": "file-jwt",
+	}
+	if len(config) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, config)
+	}
+	for key, value := range expected {
+		if config[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, config[key])
+		}
+	}
+}
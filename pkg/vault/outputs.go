@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configureOutputs exports the fields of the outputs to their targets, it runs after the rest of the
+// configuration, so that generated artifacts (CA certificates, public keys) are already there.
+// Nothing is exported in plan mode, since the outputs don't change anything in Vault.
+func (v *vault) configureOutputs(outputs []Output) error {
+	if v.plan != nil {
+		return nil
+	}
+
+	for _, output := range outputs {
+		err := v.configureOutput(output)
+		if err != nil {
+			return fmt.Errorf("error exporting %s: %s", output.Path, err.Error())
+		}
+	}
+	return nil
+}
+
+func (v *vault) configureOutput(output Output) error {
+	exists, data, err := v.readConfig(output.Path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		logrus.Warnf("%s doesn't exist (yet), skipping its output", output.Path)
+		return nil
+	}
+
+	values, err := outputValues(output.Fields, data)
+	if err != nil {
+		return err
+	}
+
+	if output.File != "" {
+		err := writeOutputFile(output.File, values[output.Fields[0]], 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if output.ConfigMap != nil {
+		data := map[string]string{}
+		for field, value := range values {
+			data[field] = string(value)
+		}
+		err := writeKubernetesConfigMap(output.ConfigMap.Namespace, output.ConfigMap.Name, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if output.K8sSecret != nil {
+		err := writeKubernetesSecret(output.K8sSecret.Namespace, output.K8sSecret.Name, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	if output.KV != "" {
+		for field, value := range values {
+			err := v.writeOutputKV(output.KV+"-"+strings.Replace(field, "_", "-", -1), value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// outputValues selects the fields from the data, values which aren't strings are exported as JSON
+func outputValues(fields []string, data map[string]interface{}) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	for _, field := range fields {
+		value, ok := data[field]
+		if !ok {
+			return nil, fmt.Errorf("no %s field", field)
+		}
+		if s, ok := value.(string); ok {
+			values[field] = []byte(s)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding %s field: %s", field, err.Error())
+		}
+		values[field] = encoded
+	}
+	return values, nil
+}
+
+// writeOutputFile writes the file if its content has changed
+func writeOutputFile(filename string, content []byte, perm os.FileMode) error {
+	existing, _ := ioutil.ReadFile(filename)
+	if bytes.Equal(existing, content) {
+		return nil
+	}
+	err := ioutil.WriteFile(filename, content, perm)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %s", filename, err.Error())
+	}
+	logrus.Infof("exported %s", filename)
+	return nil
+}
+
+// writeOutputKV sets the key store key if its value has changed
+func (v *vault) writeOutputKV(key string, value []byte) error {
+	existing, _ := v.keyStore.Get(key)
+	if bytes.Equal(existing, value) {
+		return nil
+	}
+	err := v.keyStore.Set(key, value)
+	if err != nil {
+		return fmt.Errorf("error storing %s in key store: %s", key, err.Error())
+	}
+	logrus.Infof("exported key store key %s", key)
+	return nil
+}
@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputValues(t *testing.T) {
+	data := map[string]interface{}{
+		"public_key": "ssh-rsa AAAA",
+		"ca_chain":   []interface{}{"cert1", "cert2"},
+	}
+
+	values, err := outputValues([]string{"public_key", "ca_chain"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(values["public_key"]) != "ssh-rsa AAAA" {
+		t.Errorf("expected the string as it is, got %s", values["public_key"])
+	}
+	if string(values["ca_chain"]) != `["cert1","cert2"]` {
+		t.Errorf("expected the list as JSON, got %s", values["ca_chain"])
+	}
+
+	if _, err := outputValues([]string{"certificate"}, data); err == nil || !strings.Contains(err.Error(), "no certificate field") {
+		t.Errorf("expected a missing field error, got %v", err)
+	}
+}
+
+func TestValidateOutputs(t *testing.T) {
+	config := ExternalConfig{
+		Outputs: []Output{
+			{Path: "pki/cert/ca", Fields: []string{"certificate"}, KV: "vault-pki-ca"},
+			{Path: "ssh/config/ca"},
+			{Path: "pki/cert/ca", Fields: []string{"certificate", "ca_chain"}, File: "/tmp/ca.pem"},
+			{Path: "pki/cert/ca", Fields: []string{"certificate"}, ConfigMap: &KubernetesSecretRef{}},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"outputs[1].fields missing",
+		"outputs[1].file (or configmap, k8s_secret, kv) missing",
+		"outputs[2].file can only hold a single field",
+		"outputs[3].configmap.name missing",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %s", expected, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "outputs[0]") {
+		t.Errorf("expected outputs[0] to be valid, got %s", err.Error())
+	}
+}
+
+func TestConfigureOutput(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	store := newMemoryKV()
+	v := f.vault(store)
+
+	dir, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ca.pub")
+
+	output := Output{Path: "ssh/config/ca", Fields: []string{"public_key"}, File: file, KV: "vault-ssh"}
+
+	// nothing is exported while the path doesn't exist
+	if err := v.configureOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) || len(store.data) != 0 {
+		t.Errorf("expected nothing to be exported, got %v", store.data)
+	}
+
+	f.set("ssh/config/ca", map[string]interface{}{"public_key": "ssh-rsa AAAA"})
+	if err := v.configureOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil || string(content) != "ssh-rsa AAAA" {
+		t.Errorf("expected the public key in %s, got '%s' (%v)", file, content, err)
+	}
+	if string(store.data["vault-ssh-public-key"]) != "ssh-rsa AAAA" {
+		t.Errorf("expected the public key in the key store, got %v", store.data)
+	}
+
+	// the outputs follow the changes of the path
+	f.set("ssh/config/ca", map[string]interface{}{"public_key": "ssh-rsa BBBB"})
+	if err := v.configureOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = ioutil.ReadFile(file)
+	if string(content) != "ssh-rsa BBBB" || string(store.data["vault-ssh-public-key"]) != "ssh-rsa BBBB" {
+		t.Errorf("expected the new public key to be exported, got '%s' and '%s'", content, store.data["vault-ssh-public-key"])
+	}
+
+	// a missing field fails the output
+	output.Fields = []string{"certificate"}
+	if err := v.configureOutput(output); err == nil || !strings.Contains(err.Error(), "no certificate field") {
+		t.Errorf("expected a missing field error, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// configurePKI sets up the CA of the pki secret engine mounted to path if it has none yet,
+// then writes its URLs, CRL config and roles and exports its CA certificate
+func (v *vault) configurePKI(path string, pki *PKIConfig) error {
+	caCert, err := v.pkiCACert(path)
+	if err != nil {
+		return err
+	}
+
+	if caCert == "" {
+		switch {
+		case pki.Root != nil:
+			err = v.configurePKIRoot(path, pki.Root)
+		case pki.Intermediate != nil:
+			err = v.configurePKIIntermediate(path, pki.Intermediate)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		logrus.Debugf("%s already has a CA, leaving it as it is", path)
+	}
+
+	if len(pki.URLs) > 0 {
+		err := v.writeConfig(path+"/config/urls", pki.URLs)
+		if err != nil {
+			return fmt.Errorf("error putting URLs config into vault: %s", err.Error())
+		}
+	}
+
+	if len(pki.CRL) > 0 {
+		err := v.writeConfig(path+"/config/crl", pki.CRL)
+		if err != nil {
+			return fmt.Errorf("error putting CRL config into vault: %s", err.Error())
+		}
+	}
+
+	for _, role := range pki.Roles {
+		err := v.writeConfig(fmt.Sprintf("%s/roles/%s", path, role["name"]), role)
+		if err != nil {
+			return fmt.Errorf("error putting %s role into vault: %s", role["name"], err.Error())
+		}
+	}
+
+	if pki.ExportCA != nil && v.plan == nil {
+		return v.exportPKICACert(path, pki.ExportCA)
+	}
+
+	return nil
+}
+
+// configurePKIRoot imports the root CA bundle, or generates a root CA with an internal private key
+func (v *vault) configurePKIRoot(path string, root map[string]interface{}) error {
+	if _, ok := root["pem_bundle"]; ok {
+		logrus.Infof("importing root CA into %s", path)
+		err := v.writeConfig(path+"/config/ca", map[string]interface{}{"pem_bundle": root["pem_bundle"]})
+		if err != nil {
+			return fmt.Errorf("error importing root CA into vault: %s", err.Error())
+		}
+		return nil
+	}
+
+	logrus.Infof("generating root CA in %s", path)
+	err := v.writeConfig(path+"/root/generate/internal", root)
+	if err != nil {
+		return fmt.Errorf("error generating root CA in vault: %s", err.Error())
+	}
+	return nil
+}
+
+// configurePKIIntermediate generates an intermediate CA with an internal private key,
+// has it signed by the root CA of the pki secret engine mounted to signed_by and sets it
+func (v *vault) configurePKIIntermediate(path string, intermediate map[string]interface{}) error {
+	signedBy := strings.Trim(cast.ToString(intermediate["signed_by"]), "/")
+	params := map[string]interface{}{}
+	for key, value := range intermediate {
+		if key != "signed_by" {
+			params[key] = value
+		}
+	}
+
+	generatePath := path + "/intermediate/generate/internal"
+	signPath := signedBy + "/root/sign-intermediate"
+	setSignedPath := path + "/intermediate/set-signed"
+
+	if v.plan != nil {
+		v.plan.add(ActionCreate, generatePath)
+		v.plan.add(ActionCreate, signPath)
+		v.plan.add(ActionCreate, setSignedPath)
+		return nil
+	}
+
+	logrus.Infof("generating intermediate CA in %s signed by %s", path, signedBy)
+
+	generated, err := v.cl.Logical().Write(generatePath, params)
+	if err != nil {
+		return fmt.Errorf("error generating intermediate CA in vault: %s", err.Error())
+	}
+	if generated == nil || generated.Data["csr"] == nil {
+		return fmt.Errorf("error generating intermediate CA in vault: no CSR returned")
+	}
+
+	params["csr"] = generated.Data["csr"]
+	signed, err := v.cl.Logical().Write(signPath, params)
+	if err != nil {
+		return fmt.Errorf("error signing intermediate CA with %s: %s", signedBy, err.Error())
+	}
+	if signed == nil || signed.Data["certificate"] == nil {
+		return fmt.Errorf("error signing intermediate CA with %s: no certificate returned", signedBy)
+	}
+
+	_, err = v.cl.Logical().Write(setSignedPath, map[string]interface{}{"certificate": signed.Data["certificate"]})
+	if err != nil {
+		return fmt.Errorf("error setting signed intermediate CA in vault: %s", err.Error())
+	}
+	return nil
+}
+
+// pkiCACert returns the CA certificate of the pki secret engine, or an empty string if it has none yet
+func (v *vault) pkiCACert(path string) (string, error) {
+	// Vault reports a missing CA as a client error, the mount might not exist yet in plan mode
+	_, data, err := v.readConfig(path + "/cert/ca")
+	if err != nil {
+		return "", err
+	}
+	return cast.ToString(data["certificate"]), nil
+}
+
+// exportPKICACert writes the CA certificate to a file and/or the key store, if it has changed
+func (v *vault) exportPKICACert(path string, export *PKIExport) error {
+	caCert, err := v.pkiCACert(path)
+	if err != nil || caCert == "" {
+		return err
+	}
+
+	if export.File != "" {
+		err := writeOutputFile(export.File, []byte(caCert), 0644)
+		if err != nil {
+			return fmt.Errorf("error exporting CA certificate of %s: %s", path, err.Error())
+		}
+	}
+
+	if export.KV != "" {
+		err := v.writeOutputKV(export.KV, []byte(caCert))
+		if err != nil {
+			return fmt.Errorf("error exporting CA certificate of %s: %s", path, err.Error())
+		}
+	}
+
+	return nil
+}
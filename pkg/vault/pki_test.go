@@ -0,0 +1,73 @@
+package vault
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConfigurePKI(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	store := newMemoryKV()
+	v := f.vault(store)
+
+	f.handle("PUT", "pki/root/generate/internal", func(body map[string]interface{}) (int, interface{}) {
+		f.set("pki/cert/ca", map[string]interface{}{"certificate": "ROOT " + body["common_name"].(string)})
+		return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"certificate": "ROOT"}}
+	})
+	f.handle("PUT", "pki-int/intermediate/generate/internal", func(map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"csr": "CSR"}}
+	})
+	f.handle("PUT", "pki/root/sign-intermediate", func(body map[string]interface{}) (int, interface{}) {
+		if body["csr"] != "CSR" || body["signed_by"] != nil {
+			t.Errorf("unexpected sign-intermediate request: %v", body)
+		}
+		return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"certificate": "INTERMEDIATE"}}
+	})
+	f.handle("PUT", "pki-int/intermediate/set-signed", func(body map[string]interface{}) (int, interface{}) {
+		f.set("pki-int/cert/ca", map[string]interface{}{"certificate": body["certificate"]})
+		return http.StatusNoContent, nil
+	})
+
+	root := &PKIConfig{
+		Root:     map[string]interface{}{"common_name": "example.com", "ttl": "87600h"},
+		URLs:     map[string]interface{}{"issuing_certificates": "https://vault/v1/pki/ca"},
+		Roles:    []map[string]interface{}{{"name": "example-dot-com", "allowed_domains": "example.com"}},
+		ExportCA: &PKIExport{KV: "vault-pki-ca"},
+	}
+	intermediate := &PKIConfig{
+		Intermediate: map[string]interface{}{"common_name": "int.example.com", "signed_by": "pki"},
+	}
+
+	// the CAs are set up only once
+	for i := 0; i < 2; i++ {
+		if err := v.configurePKI("pki", root); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.configurePKI("pki-int", intermediate); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if f.count("PUT", "pki/root/generate/internal") != 1 || f.count("PUT", "pki-int/intermediate/generate/internal") != 1 {
+		t.Errorf("expected the CAs to be generated once, got %v", f.requests)
+	}
+	if f.get("pki-int/cert/ca")["certificate"] != "INTERMEDIATE" {
+		t.Error("expected the signed intermediate CA to be set")
+	}
+	if f.get("pki/config/urls")["issuing_certificates"] != "https://vault/v1/pki/ca" || f.get("pki/roles/example-dot-com") == nil {
+		t.Error("expected the URLs and the roles to be written")
+	}
+	if string(store.data["vault-pki-ca"]) != "ROOT example.com" {
+		t.Errorf("expected the CA certificate to be exported, got '%s'", store.data["vault-pki-ca"])
+	}
+
+	// plan mode doesn't generate anything
+	v.plan = &Plan{}
+	if err := v.configurePKI("pki-new", intermediate); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.plan.Changes) != 3 || f.count("PUT", "pki-new/intermediate/generate/internal") != 0 {
+		t.Errorf("expected the intermediate CA setup to be planned, got %v", v.plan.Changes)
+	}
+}
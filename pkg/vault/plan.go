@@ -0,0 +1,308 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cast"
+)
+
+// Action is the kind of a change Configure makes in Vault
+type Action string
+
+// The actions of the planned changes
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionMove   Action = "move"
+	ActionDelete Action = "delete"
+)
+
+// Change is a single change Configure would make in Vault
+type Change struct {
+	Action Action `json:"action"`
+	Path   string `json:"path"`
+	// Fields lists the changed fields of an update
+	Fields []string `json:"fields,omitempty"`
+	// To is the new path of a move
+	To string `json:"to,omitempty"`
+}
+
+// Plan holds the changes Configure would make in Vault, based on the current configuration
+type Plan struct {
+	Changes []Change `json:"changes"`
+	// Warnings are about the state of Vault which Configure leaves as it is, e.g. removed secret engines
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (p *Plan) add(action Action, path string, fields ...string) {
+	p.Changes = append(p.Changes, Change{Action: action, Path: path, Fields: fields})
+}
+
+// Empty returns true if Configure wouldn't change anything in Vault
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// JSON returns the plan in JSON format
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// String returns the plan in a human readable format
+func (p *Plan) String() string {
+	buffer := bytes.NewBuffer(nil)
+
+	if p.Empty() {
+		buffer.WriteString("No changes, Vault is up to date with the configuration.\n")
+	} else {
+		counts := map[Action]int{}
+		for _, change := range p.Changes {
+			counts[change.Action]++
+			switch change.Action {
+			case ActionCreate:
+				fmt.Fprintf(buffer, "  + %s\n", change.Path)
+			case ActionUpdate:
+				fmt.Fprintf(buffer, "  ~ %s (%s)\n", change.Path, strings.Join(change.Fields, ", "))
+			case ActionMove:
+				fmt.Fprintf(buffer, "  > %s -> %s\n", change.Path, change.To)
+			case ActionDelete:
+				fmt.Fprintf(buffer, "  - %s\n", change.Path)
+			}
+		}
+		fmt.Fprintf(buffer, "\nPlan: %d to create, %d to update, %d to move, %d to delete.\n",
+			counts[ActionCreate], counts[ActionUpdate], counts[ActionMove], counts[ActionDelete])
+	}
+
+	for _, warning := range p.Warnings {
+		fmt.Fprintf(buffer, "\nWarning: %s\n", warning)
+	}
+
+	return buffer.String()
+}
+
+// Plan computes the changes Configure would make in Vault, without writing anything
+func (v *vault) Plan(config *ExternalConfig) (*Plan, error) {
+	v.plan = &Plan{}
+	defer func() { v.plan = nil }()
+
+	if err := v.Configure(config); err != nil {
+		return nil, err
+	}
+
+	return v.plan, nil
+}
+
+// writeConfig writes data to the path, in plan mode it records the change instead
+func (v *vault) writeConfig(path string, data map[string]interface{}) error {
+	if v.plan == nil {
+		_, err := v.cl.Logical().Write(path, data)
+		return err
+	}
+
+	// paths which can't be read (yet) are considered as new
+	secret, err := v.cl.Logical().Read(path)
+	if err != nil || secret == nil || secret.Data == nil {
+		v.plan.add(ActionCreate, path)
+		return nil
+	}
+
+	if fields := changedFields(data, secret.Data); len(fields) > 0 {
+		v.plan.add(ActionUpdate, path, fields...)
+	}
+	return nil
+}
+
+// deleteConfig deletes the path, in plan mode it records the deletion instead
+func (v *vault) deleteConfig(path string) error {
+	if v.plan != nil {
+		v.plan.add(ActionDelete, path)
+		return nil
+	}
+	_, err := v.cl.Logical().Delete(path)
+	return err
+}
+
+func (v *vault) enableAuth(path string, options *api.EnableAuthOptions) error {
+	if v.plan != nil {
+		v.plan.add(ActionCreate, "sys/auth/"+path)
+		return nil
+	}
+	return v.cl.Sys().EnableAuthWithOptions(path, options)
+}
+
+func (v *vault) disableAuth(path string) error {
+	if v.plan != nil {
+		v.plan.add(ActionDelete, "sys/auth/"+path)
+		return nil
+	}
+	return v.cl.Sys().DisableAuth(path)
+}
+
+func (v *vault) putPolicy(name, rules string) error {
+	if v.plan == nil {
+		return v.cl.Sys().PutPolicy(name, rules)
+	}
+
+	existingRules, err := v.cl.Sys().GetPolicy(name)
+	if err != nil {
+		return fmt.Errorf("error reading %s policy from vault: %s", name, err.Error())
+	}
+	if existingRules == "" {
+		v.plan.add(ActionCreate, "sys/policy/"+name)
+	} else if normalizeWhitespace(existingRules) != normalizeWhitespace(rules) {
+		v.plan.add(ActionUpdate, "sys/policy/"+name, "rules")
+	}
+	return nil
+}
+
+func (v *vault) deletePolicy(name string) error {
+	if v.plan != nil {
+		v.plan.add(ActionDelete, "sys/policy/"+name)
+		return nil
+	}
+	return v.cl.Sys().DeletePolicy(name)
+}
+
+func (v *vault) mount(path string, input *api.MountInput) error {
+	if v.plan != nil {
+		v.plan.add(ActionCreate, "sys/mounts/"+path)
+		return nil
+	}
+	return v.cl.Sys().Mount(path, input)
+}
+
+// remount moves a secret engine with its data and leases, in plan mode it records the move instead
+func (v *vault) remount(from, to string) error {
+	if v.plan != nil {
+		v.plan.Changes = append(v.plan.Changes, Change{Action: ActionMove, Path: "sys/mounts/" + from, To: "sys/mounts/" + to})
+		return nil
+	}
+	return v.cl.Sys().Remount(from, to)
+}
+
+func (v *vault) unmount(path string) error {
+	if v.plan != nil {
+		v.plan.add(ActionDelete, "sys/mounts/"+path)
+		return nil
+	}
+	return v.cl.Sys().Unmount(path)
+}
+
+func (v *vault) enableAudit(path string, options *api.EnableAuditOptions) error {
+	if v.plan != nil {
+		v.plan.add(ActionCreate, "sys/audit/"+path)
+		return nil
+	}
+	return v.cl.Sys().EnableAuditWithOptions(path, options)
+}
+
+func (v *vault) disableAudit(path string) error {
+	if v.plan != nil {
+		v.plan.add(ActionDelete, "sys/audit/"+path)
+		return nil
+	}
+	return v.cl.Sys().DisableAudit(path)
+}
+
+// changedFields returns the sorted names of the fields in desired which differ from
+// the ones in actual, fields not returned by Vault (e.g. passwords) can't be compared
+func changedFields(desired, actual map[string]interface{}) []string {
+	fields := []string{}
+	for key, value := range desired {
+		actualValue, ok := actual[key]
+		if !ok {
+			continue
+		}
+		if !valuesEqual(value, actualValue) {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// valuesEqual compares a value from the configuration with one returned by Vault,
+// taking into account that Vault returns durations in seconds and lists as arrays
+func valuesEqual(desired, actual interface{}) bool {
+	// Vault returns null for empty lists and maps
+	if actual == nil {
+		value := reflect.ValueOf(desired)
+		switch value.Kind() {
+		case reflect.Invalid:
+			return true
+		case reflect.Map, reflect.Slice, reflect.String:
+			return value.Len() == 0
+		}
+		return false
+	}
+
+	if actualList, ok := actual.([]interface{}); ok {
+		desiredList := []interface{}{}
+		switch d := desired.(type) {
+		case string:
+			for _, item := range strings.Split(d, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					desiredList = append(desiredList, item)
+				}
+			}
+		case []interface{}:
+			desiredList = d
+		default:
+			for _, item := range cast.ToStringSlice(d) {
+				desiredList = append(desiredList, item)
+			}
+		}
+		if len(desiredList) != len(actualList) {
+			return false
+		}
+		for i := range desiredList {
+			if !valuesEqual(desiredList[i], actualList[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if actualNumber, ok := actual.(json.Number); ok {
+		if desiredString, ok := desired.(string); ok {
+			if duration, err := time.ParseDuration(desiredString); err == nil {
+				return actualNumber.String() == fmt.Sprint(int64(duration.Seconds()))
+			}
+		}
+	}
+
+	if actualMap, ok := actual.(map[string]interface{}); ok {
+		desiredMap := reflect.ValueOf(desired)
+		if desiredMap.Kind() != reflect.Map {
+			return false
+		}
+		for _, key := range desiredMap.MapKeys() {
+			if !valuesEqual(desiredMap.MapIndex(key).Interface(), actualMap[fmt.Sprint(key.Interface())]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if reflect.DeepEqual(desired, actual) {
+		return true
+	}
+
+	desiredString, desiredErr := cast.ToStringE(desired)
+	actualString, actualErr := cast.ToStringE(actual)
+	if desiredErr == nil && actualErr == nil {
+		return desiredString == actualString
+	}
+	return fmt.Sprint(desired) == fmt.Sprint(actual)
+}
+
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
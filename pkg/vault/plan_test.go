@@ -0,0 +1,60 @@
+package vault
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPlanString(t *testing.T) {
+	plan := Plan{}
+	plan.add(ActionCreate, "sys/mounts/kv")
+	plan.Changes = append(plan.Changes, Change{Action: ActionMove, Path: "sys/mounts/secret", To: "sys/mounts/apps"})
+
+	expected := "  + sys/mounts/kv\n  > sys/mounts/secret -> sys/mounts/apps\n\nPlan: 1 to create, 0 to update, 1 to move, 0 to delete.\n"
+	if plan.String() != expected {
+		t.Errorf("expected plan:\n%s\ngot:\n%s", expected, plan.String())
+	}
+}
+
+func TestPlanWarnsAboutRemovedSecretEngines(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	f.handle("GET", "sys/mounts", func(map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{
+			"sys/":       map[string]interface{}{"type": "system"},
+			"cubbyhole/": map[string]interface{}{"type": "cubbyhole"},
+			"kv/":        map[string]interface{}{"type": "kv"},
+			"apps/":      map[string]interface{}{"type": "kv"},
+			"secret/":    map[string]interface{}{"type": "kv"},
+			"old/":       map[string]interface{}{"type": "kv"},
+		}
+	})
+
+	v := f.vault(newMemoryKV())
+	v.plan = &Plan{}
+	config := &ExternalConfig{
+		Secrets: []SecretEngine{
+			{Type: "kv", Path: "kv"},
+			{Type: "kv", Path: "apps-v2", PreviousPath: "apps"},
+		},
+		PurgeUnmanagedConfig: &PurgeConfig{Exclude: PurgeExclude{Secrets: []string{"secret"}}},
+	}
+
+	err := v.warnRemovedSecretEngines(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.plan.Warnings) != 1 || !strings.HasPrefix(v.plan.Warnings[0], "old secret engine is not in the configuration") {
+		t.Errorf("expected a warning about the old secret engine, got %v", v.plan.Warnings)
+	}
+	if !strings.Contains(v.plan.String(), "\nWarning: old secret engine") {
+		t.Errorf("expected the warning in the plan, got:\n%s", v.plan.String())
+	}
+
+	config.PurgeUnmanagedConfig.Enabled = true
+	v.plan = &Plan{}
+	if err := v.warnRemovedSecretEngines(config); err != nil || len(v.plan.Warnings) != 0 {
+		t.Errorf("expected no warnings in managed mode, got %v, %v", v.plan.Warnings, err)
+	}
+}
@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configurePlugins registers the plugins in the plugin catalog, or re-registers them if they
+// have changed (e.g. the checksum of a new binary), so that they can be mounted afterwards
+func (v *vault) configurePlugins(plugins []Plugin) error {
+	for _, plugin := range plugins {
+		checksum, err := pluginChecksum(plugin)
+		if err != nil {
+			return fmt.Errorf("error checking %s plugin: %s", plugin.Name, err.Error())
+		}
+
+		data := map[string]interface{}{
+			"command": plugin.Command,
+			"args":    append([]string{}, plugin.Args...),
+			"sha256":  checksum,
+		}
+		if len(plugin.Env) > 0 {
+			data["env"] = plugin.Env
+		}
+
+		path := "sys/plugins/catalog/" + plugin.Name
+		exists, existing, err := v.readConfig(path)
+		if err != nil {
+			return err
+		}
+		if exists && len(changedFields(data, existing)) == 0 {
+			logrus.Debugf("%s plugin is already registered in vault", plugin.Name)
+			continue
+		}
+
+		logrus.Infof("registering %s plugin in vault", plugin.Name)
+		err = v.writeConfig(path, data)
+		if err != nil {
+			return fmt.Errorf("error registering %s plugin in vault: %s", plugin.Name, err.Error())
+		}
+
+		// the mounts of the plugin keep running the previous binary until they are reloaded
+		if exists && v.plan == nil {
+			_, err := v.cl.Logical().Write("sys/plugins/reload/backend", map[string]interface{}{"plugin": plugin.Name})
+			if err != nil {
+				logrus.Warnf("error reloading the mounts of %s plugin, they have to be remounted: %s", plugin.Name, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// pluginChecksum returns the SHA256 checksum of the plugin, if the plugin directory is set,
+// it is computed from the binary and checked against the configured one
+func pluginChecksum(plugin Plugin) (string, error) {
+	if plugin.Directory == "" {
+		return plugin.SHA256, nil
+	}
+
+	file, err := os.Open(filepath.Join(plugin.Directory, plugin.Command))
+	if err != nil {
+		return "", fmt.Errorf("error opening plugin binary: %s", err.Error())
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading plugin binary: %s", err.Error())
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	if plugin.SHA256 != "" && plugin.SHA256 != checksum {
+		return "", fmt.Errorf("the SHA256 checksum of %s is %s instead of %s", file.Name(), checksum, plugin.SHA256)
+	}
+	return checksum, nil
+}
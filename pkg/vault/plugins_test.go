@@ -0,0 +1,38 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPluginChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "my-plugin"), []byte("plugin"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const checksum = "5e689e2b01672bf33996e75d5e372ff60c536ce1599a1458e867cd8f4bef5160"
+
+	plugin := Plugin{Name: "my-plugin", Command: "my-plugin", SHA256: "1234"}
+	if sum, err := pluginChecksum(plugin); err != nil || sum != "1234" {
+		t.Errorf("expected the configured checksum without a directory, got %s, %v", sum, err)
+	}
+
+	plugin.Directory = dir
+	if _, err := pluginChecksum(plugin); err == nil || !strings.Contains(err.Error(), "instead of 1234") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+
+	plugin.SHA256 = ""
+	if sum, err := pluginChecksum(plugin); err != nil || sum != checksum {
+		t.Errorf("expected checksum %s, got %s, %v", checksum, sum, err)
+	}
+}
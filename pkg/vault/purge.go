@@ -0,0 +1,193 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// builtinAuthMethods, builtinPolicies and builtinSecretEngines can't or shouldn't be removed from Vault
+var builtinAuthMethods = []string{"token"}
+var builtinPolicies = []string{"default", "root"}
+var builtinSecretEngines = []string{"sys", "cubbyhole", "identity"}
+
+// purgeUnmanagedConfig removes the auth methods, policies, secret engines and audit
+// devices which are not present in the config, if the managed mode is enabled
+func (v *vault) purgeUnmanagedConfig(config *ExternalConfig) error {
+	if config.PurgeUnmanagedConfig == nil || !config.PurgeUnmanagedConfig.Enabled {
+		return nil
+	}
+
+	authMethods, err := v.unmanagedAuthMethods(config)
+	if err != nil {
+		return err
+	}
+	for _, path := range authMethods {
+		logrus.Warnf("disabling unmanaged %s auth method...", path)
+		if err := v.disableAuth(path); err != nil {
+			return fmt.Errorf("error disabling %s auth method in vault: %s", path, err.Error())
+		}
+	}
+
+	policies, err := v.unmanagedPolicies(config)
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		logrus.Warnf("deleting unmanaged %s policy...", policy)
+		if err := v.deletePolicy(policy); err != nil {
+			return fmt.Errorf("error deleting %s policy from vault: %s", policy, err.Error())
+		}
+	}
+
+	secretEngines, err := v.unmanagedSecretEngines(config)
+	if err != nil {
+		return err
+	}
+	for _, path := range secretEngines {
+		logrus.Warnf("unmounting unmanaged %s secret engine, all of its data is lost...", path)
+		if err := v.unmount(path); err != nil {
+			return fmt.Errorf("error unmounting %s secret engine from vault: %s", path, err.Error())
+		}
+	}
+
+	auditDevices, err := v.unmanagedAuditDevices(config)
+	if err != nil {
+		return err
+	}
+	for _, path := range auditDevices {
+		logrus.Warnf("disabling unmanaged %s audit device...", path)
+		if err := v.disableAudit(path); err != nil {
+			return fmt.Errorf("error disabling %s audit device in vault: %s", path, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// unmanagedAuthMethods returns the paths of the auth methods in Vault not present in the config
+func (v *vault) unmanagedAuthMethods(config *ExternalConfig) ([]string, error) {
+	existingAuths, err := v.cl.Sys().ListAuth()
+	if err != nil {
+		return nil, fmt.Errorf("error listing auth backends vault: %s", err.Error())
+	}
+
+	managed := append(append([]string{}, builtinAuthMethods...), config.PurgeUnmanagedConfig.Exclude.Auth...)
+	for _, authMethod := range config.Auth {
+		managed = append(managed, authMethod.MountPath())
+	}
+
+	unmanaged := []string{}
+	for path := range existingAuths {
+		if !containsPath(managed, path) {
+			unmanaged = append(unmanaged, strings.TrimSuffix(path, "/"))
+		}
+	}
+	return unmanaged, nil
+}
+
+// unmanagedPolicies returns the names of the policies in Vault not present in the config
+func (v *vault) unmanagedPolicies(config *ExternalConfig) ([]string, error) {
+	existingPolicies, err := v.cl.Sys().ListPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("error listing policies in vault: %s", err.Error())
+	}
+
+	managed := append(append([]string{}, builtinPolicies...), config.PurgeUnmanagedConfig.Exclude.Policies...)
+	for _, policy := range config.Policies {
+		managed = append(managed, policy.Name)
+	}
+
+	unmanaged := []string{}
+	for _, policy := range existingPolicies {
+		if !containsPath(managed, policy) {
+			unmanaged = append(unmanaged, policy)
+		}
+	}
+	return unmanaged, nil
+}
+
+// unmanagedSecretEngines returns the paths of the secret engines in Vault not present in the config
+func (v *vault) unmanagedSecretEngines(config *ExternalConfig) ([]string, error) {
+	existingMounts, err := v.cl.Sys().ListMounts()
+	if err != nil {
+		return nil, fmt.Errorf("error reading mounts from vault: %s", err.Error())
+	}
+
+	managed := append([]string{}, builtinSecretEngines...)
+	if config.PurgeUnmanagedConfig != nil {
+		managed = append(managed, config.PurgeUnmanagedConfig.Exclude.Secrets...)
+	}
+	for _, secretEngine := range config.Secrets {
+		// a previous path left mounted next to the new one is kept, since it can't be moved
+		managed = append(managed, secretEngine.MountPath(), secretEngine.PreviousPath)
+	}
+
+	unmanaged := []string{}
+	for path := range existingMounts {
+		if !containsPath(managed, path) {
+			unmanaged = append(unmanaged, strings.TrimSuffix(path, "/"))
+		}
+	}
+	sort.Strings(unmanaged)
+	return unmanaged, nil
+}
+
+// unmanagedAuditDevices returns the paths of the audit devices in Vault not present in the config
+func (v *vault) unmanagedAuditDevices(config *ExternalConfig) ([]string, error) {
+	existingAudits, err := v.cl.Sys().ListAudit()
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit devices in vault: %s", err.Error())
+	}
+
+	managed := append([]string{}, config.PurgeUnmanagedConfig.Exclude.Audit...)
+	for _, auditDevice := range config.Audit {
+		managed = append(managed, auditDevice.MountPath())
+	}
+
+	unmanaged := []string{}
+	for path := range existingAudits {
+		if !containsPath(managed, path) {
+			unmanaged = append(unmanaged, strings.TrimSuffix(path, "/"))
+		}
+	}
+	return unmanaged, nil
+}
+
+// warnRemovedSecretEngines warns about the mounted secret engines which are neither in the config nor
+// excluded, e.g. because they were removed from it or moved without previous_path, they are left mounted
+// with all of their data, unless the managed mode unmounts them. In plan mode the warnings go to the plan.
+func (v *vault) warnRemovedSecretEngines(config *ExternalConfig) error {
+	if config.PurgeUnmanagedConfig != nil && config.PurgeUnmanagedConfig.Enabled {
+		return nil
+	}
+
+	unmanaged, err := v.unmanagedSecretEngines(config)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range unmanaged {
+		warning := fmt.Sprintf("%s secret engine is not in the configuration, but it is still mounted with all of its data: "+
+			"set previous_path: %s on the secret engine it was moved to, unmount it or exclude it", path, path)
+		if v.plan != nil {
+			v.plan.Warnings = append(v.plan.Warnings, warning)
+		} else {
+			logrus.Warn(warning)
+		}
+	}
+	return nil
+}
+
+// containsPath checks if the paths contain path, ignoring the trailing slashes
+func containsPath(paths []string, path string) bool {
+	path = strings.Trim(path, "/")
+	for _, p := range paths {
+		if strings.Trim(p, "/") == path {
+			return true
+		}
+	}
+	return false
+}
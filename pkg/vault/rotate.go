@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jacohend/bank-vaults/pkg/kv"
+	"github.com/sirupsen/logrus"
+)
+
+// rotateRootKeyPrefix is the prefix of the key store keys recording the root credential rotations
+const rotateRootKeyPrefix = "vault-rotate-root-"
+
+// rotateRootHMACKey is the key store key of the HMAC key of the recorded configuration items, so that
+// the records can't be used to guess the (bootstrap) credentials in the items
+const rotateRootHMACKey = "vault-rotate-root-hmac-key"
+
+// rotateRootPath returns the rotate-root endpoint of a configuration path (relative to the mount) holding
+// the root credentials of a secret engine: the connections of the database and the root config of the
+// aws secret engine, written either by the configuration (config/<name>) or by the paths (config/root)
+func rotateRootPath(secretEngine SecretEngine, configPath string) string {
+	if !secretEngine.RotateRoot {
+		return ""
+	}
+	path := secretEngine.MountPath()
+	configPath = strings.Trim(configPath, "/")
+	switch secretEngine.Type {
+	case "database":
+		if name := strings.TrimPrefix(configPath, "config/"); name != configPath && name != "" && !strings.Contains(name, "/") {
+			return fmt.Sprintf("%s/rotate-root/%s", path, name)
+		}
+	case "aws":
+		if configPath == "config/root" {
+			return path + "/config/rotate-root"
+		}
+	}
+	return ""
+}
+
+// rootRotated checks whether the root credentials of the configuration item have been rotated since the
+// item was last changed, in that case the item must not be written again, since it would undo the rotation
+func (v *vault) rootRotated(configPath string, item map[string]interface{}) (bool, error) {
+	// the HMAC key is stored before the item is written the first time, so that key stores which don't
+	// keep the records (e.g. the dev one) are refused before the bootstrap credentials are written
+	key, err := v.rotateRootHMACKey(v.plan == nil)
+	if err != nil || key == nil {
+		return false, err
+	}
+
+	recorded, err := v.keyStore.Get(rotateRootKey(configPath))
+	if _, ok := err.(*kv.NotFoundError); ok {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error checking root credential rotation of %s: %s", configPath, err.Error())
+	}
+
+	checksum, err := rotateRootChecksum(key, item)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(recorded, []byte(checksum)), nil
+}
+
+// rotateRoot rotates the root credentials written by the configuration item and records it in the key store
+func (v *vault) rotateRoot(configPath, rotatePath string, item map[string]interface{}) error {
+	if v.plan != nil {
+		v.plan.add(ActionUpdate, rotatePath, "root credentials")
+		return nil
+	}
+
+	logrus.Infof("rotating root credentials of %s", configPath)
+	_, err := v.cl.Logical().Write(rotatePath, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("error rotating root credentials of %s: %s", configPath, err.Error())
+	}
+
+	key, err := v.rotateRootHMACKey(true)
+	if err != nil {
+		return err
+	}
+	checksum, err := rotateRootChecksum(key, item)
+	if err != nil {
+		return err
+	}
+	err = v.keyStore.Set(rotateRootKey(configPath), []byte(checksum))
+	if err != nil {
+		return fmt.Errorf("error recording root credential rotation of %s: %s", configPath, err.Error())
+	}
+	return nil
+}
+
+// rotateRootHMACKey returns the HMAC key of the records from the key store, it is generated if
+// create is set and there is none yet, otherwise nil is returned in that case
+func (v *vault) rotateRootHMACKey(create bool) ([]byte, error) {
+	key, err := v.keyStore.Get(rotateRootHMACKey)
+	if _, ok := err.(*kv.NotFoundError); ok {
+		if !create {
+			return nil, nil
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("error generating root credential rotation HMAC key: %s", err.Error())
+		}
+		err = v.keepRecord(rotateRootHMACKey, []byte(hex.EncodeToString(key)))
+		if err != nil {
+			return nil, fmt.Errorf("error storing root credential rotation HMAC key: %s", err.Error())
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading root credential rotation HMAC key: %s", err.Error())
+	}
+	return hex.DecodeString(string(key))
+}
+
+// rotateRootChecksum identifies the configuration item with an HMAC, so that it is rotated again if it changes
+func rotateRootChecksum(key []byte, item map[string]interface{}) (string, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func rotateRootKey(configPath string) string {
+	return rotateRootKeyPrefix + strings.Replace(strings.Trim(configPath, "/"), "/", "-", -1)
+}
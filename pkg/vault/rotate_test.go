@@ -0,0 +1,86 @@
+package vault
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestRotateRootPath(t *testing.T) {
+	database := SecretEngine{Type: "database", Path: "db", RotateRoot: true}
+	aws := SecretEngine{Type: "aws", RotateRoot: true}
+
+	tests := []struct {
+		secretEngine SecretEngine
+		configPath   string
+		expected     string
+	}{
+		{database, "config/mysql", "db/rotate-root/mysql"},
+		{database, "roles/pipeline", ""},
+		{aws, "config/root", "aws/config/rotate-root"},
+		{aws, "/config/root/", "aws/config/rotate-root"},
+		{aws, "config/lease", ""},
+		{SecretEngine{Type: "database"}, "config/mysql", ""},
+	}
+
+	for _, test := range tests {
+		path := rotateRootPath(test.secretEngine, test.configPath)
+		if path != test.expected {
+			t.Errorf("expected '%s' rotate-root path for %s/%s, got '%s'", test.expected, test.secretEngine.MountPath(), test.configPath, path)
+		}
+	}
+}
+
+func TestRotateRootOfPaths(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	store := newMemoryKV()
+	v := f.vault(store)
+
+	root := map[string]interface{}{"access_key": "AKIA", "secret_key": "bootstrap"}
+	aws := SecretEngine{Type: "aws", RotateRoot: true, Paths: []SecretEnginePath{{Path: "config/root", Data: root}}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := v.configureSecretEnginePaths(aws); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.count("PUT", "aws/config/root") != 1 || f.count("PUT", "aws/config/rotate-root") != 1 {
+		t.Errorf("expected aws/config/root to be written and rotated once, got %v", f.requests)
+	}
+
+	// the record can't be used to check guesses of the bootstrap credentials without the HMAC key
+	key, _ := hex.DecodeString(string(store.data[rotateRootHMACKey]))
+	checksum, _ := rotateRootChecksum(key, root)
+	if recorded := string(store.data["vault-rotate-root-aws-config-root"]); len(key) != 32 || recorded != checksum {
+		t.Errorf("expected an HMAC record, got '%s'", recorded)
+	}
+
+	root["secret_key"] = "changed"
+	if _, err := v.configureSecretEnginePaths(aws); err != nil {
+		t.Fatal(err)
+	}
+	if f.count("PUT", "aws/config/root") != 2 || f.count("PUT", "aws/config/rotate-root") != 2 {
+		t.Errorf("expected the changed aws/config/root to be written and rotated again, got %v", f.requests)
+	}
+}
+
+func TestRotateRootDiscardingKeyStore(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	v := f.vault(nil)
+	v.keyStore = discardKV{}
+
+	aws := SecretEngine{Type: "aws", RotateRoot: true, Paths: []SecretEnginePath{
+		{Path: "config/root", Data: map[string]interface{}{"access_key": "AKIA", "secret_key": "bootstrap"}},
+	}}
+
+	// the bootstrap credentials would be written over the rotated ones on every run
+	_, err := v.configureSecretEnginePaths(aws)
+	if err == nil || !strings.Contains(err.Error(), "doesn't keep the records") {
+		t.Errorf("expected the key store to be refused, got %v", err)
+	}
+	if f.count("PUT", "aws/config/root") != 0 {
+		t.Errorf("expected nothing to be written, got %v", f.requests)
+	}
+}
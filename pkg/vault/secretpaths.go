@@ -0,0 +1,115 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configureSecretEnginePaths writes the paths of the secret engine according to their modes, it returns
+// the paths which weren't written with the reason, e.g. because they exist
+func (v *vault) configureSecretEnginePaths(secretEngine SecretEngine) ([]string, error) {
+	skipped := []string{}
+	mountPath := strings.Trim(secretEngine.MountPath(), "/")
+
+	for _, enginePath := range secretEngine.Paths {
+		path := fmt.Sprintf("%s/%s", mountPath, strings.Trim(enginePath.Path, "/"))
+		data := enginePath.Data
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+
+		rotatePath := rotateRootPath(secretEngine, enginePath.Path)
+		if rotatePath != "" {
+			rotated, err := v.rootRotated(path, data)
+			if err != nil {
+				return skipped, err
+			}
+			if rotated {
+				logrus.Debugf("the root credentials of %s are rotated, it isn't written again", path)
+				continue
+			}
+		}
+
+		switch enginePath.Mode {
+		case WriteModeCreate:
+			exists, _, err := v.readConfig(path)
+			if err != nil {
+				return skipped, err
+			}
+			if exists {
+				skipped = append(skipped, path+" (it exists and its mode is create)")
+				continue
+			}
+			err = v.writeConfig(path, data)
+			if err != nil {
+				return skipped, fmt.Errorf("error putting %s config into vault: %s", path, err.Error())
+			}
+
+		case WriteModeReplace:
+			exists, actual, err := v.readConfig(path)
+			if err != nil {
+				return skipped, err
+			}
+			if exists {
+				fields := changedFields(data, actual)
+				if len(fields) == 0 {
+					logrus.Debugf("%s is up to date, it isn't replaced", path)
+					continue
+				}
+				logrus.Infof("replacing %s, changed fields: %s", path, strings.Join(fields, ", "))
+				err := v.deleteConfig(path)
+				if err != nil {
+					return skipped, fmt.Errorf("error deleting %s config from vault: %s", path, err.Error())
+				}
+				if v.plan != nil {
+					v.plan.add(ActionCreate, path)
+					continue
+				}
+			}
+			err = v.writeConfig(path, data)
+			if err != nil {
+				return skipped, fmt.Errorf("error putting %s config into vault: %s", path, err.Error())
+			}
+
+		default:
+			err := v.writeConfig(path, data)
+			if err != nil {
+				if isOverwriteProbihitedError(err) {
+					skipped = append(skipped, path+" (it can't be overwritten, use replace mode)")
+					continue
+				}
+				return skipped, fmt.Errorf("error putting %s config into vault: %s", path, err.Error())
+			}
+		}
+
+		if rotatePath != "" {
+			err := v.rotateRoot(path, rotatePath, data)
+			if err != nil {
+				return skipped, err
+			}
+		}
+	}
+
+	return skipped, nil
+}
+
+// readConfig reads the path, paths which don't exist (yet) are reported as missing instead of an error
+func (v *vault) readConfig(path string) (bool, map[string]interface{}, error) {
+	secret, err := v.cl.Logical().Read(path)
+	if err != nil {
+		if isClientError(err) {
+			return false, nil, nil
+		}
+		return false, nil, fmt.Errorf("error reading %s config from vault: %s", path, err.Error())
+	}
+	if secret == nil || secret.Data == nil {
+		return false, nil, nil
+	}
+	return true, secret.Data, nil
+}
+
+func isClientError(err error) bool {
+	return strings.Contains(err.Error(), "Code: 400") || strings.Contains(err.Error(), "Code: 404")
+}
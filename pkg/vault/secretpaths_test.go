@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigureSecretEnginePaths(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	v := f.vault(newMemoryKV())
+
+	f.set("ssh/config/ca", map[string]interface{}{"public_key": "ssh-rsa OLD"})
+	f.set("ssh/config/zeroaddress", map[string]interface{}{"roles": []interface{}{"otp"}})
+	f.set("transit/keys/app/config", map[string]interface{}{"deletion_allowed": false})
+	f.handle("PUT", "pki/config/ca", func(map[string]interface{}) (int, interface{}) {
+		return http.StatusBadRequest, map[string]interface{}{"errors": []string{"keys exist, delete them before reconfiguring"}}
+	})
+
+	paths := []SecretEnginePath{
+		{Path: "config/ca", Mode: WriteModeCreate, Data: map[string]interface{}{"generate_signing_key": true}},
+		{Path: "roles/otp", Mode: WriteModeCreate, Data: map[string]interface{}{"key_type": "otp"}},
+		{Path: "config/zeroaddress", Mode: WriteModeReplace, Data: map[string]interface{}{"roles": "otp"}},
+	}
+	skipped, err := v.configureSecretEnginePaths(SecretEngine{Type: "ssh", Paths: paths})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(skipped, []string{"ssh/config/ca (it exists and its mode is create)"}) {
+		t.Errorf("expected the existing ssh/config/ca to be skipped, got %v", skipped)
+	}
+	if f.count("PUT", "ssh/config/ca") != 0 || f.get("ssh/config/ca")["public_key"] != "ssh-rsa OLD" {
+		t.Error("expected ssh/config/ca not to be written")
+	}
+	if f.get("ssh/roles/otp")["key_type"] != "otp" {
+		t.Error("expected ssh/roles/otp to be created")
+	}
+	if f.count("DELETE", "ssh/config/zeroaddress") != 0 || f.count("PUT", "ssh/config/zeroaddress") != 0 {
+		t.Error("expected the unchanged ssh/config/zeroaddress not to be replaced")
+	}
+
+	// replaced configuration is deleted before it is written again
+	skipped, err = v.configureSecretEnginePaths(SecretEngine{Type: "transit", Paths: []SecretEnginePath{
+		{Path: "keys/app/config", Mode: WriteModeReplace, Data: map[string]interface{}{"deletion_allowed": true}},
+	}})
+	if err != nil || len(skipped) != 0 {
+		t.Fatalf("unexpected result: %v, %v", skipped, err)
+	}
+	if f.count("DELETE", "transit/keys/app/config") != 1 || f.get("transit/keys/app/config")["deletion_allowed"] != true {
+		t.Errorf("expected transit/keys/app/config to be replaced, got %v", f.get("transit/keys/app/config"))
+	}
+
+	// configuration which can't be overwritten is skipped in update mode
+	skipped, err = v.configureSecretEnginePaths(SecretEngine{Type: "pki", Paths: []SecretEnginePath{
+		{Path: "config/ca", Data: map[string]interface{}{"pem_bundle": "..."}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0], "use replace mode") {
+		t.Errorf("expected pki/config/ca to be skipped, got %v", skipped)
+	}
+}
+
+func TestConfigureSecretEnginePathsPlan(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	v := f.vault(newMemoryKV())
+	v.plan = &Plan{}
+
+	f.set("ssh/config/zeroaddress", map[string]interface{}{"roles": []interface{}{"otp"}})
+
+	_, err := v.configureSecretEnginePaths(SecretEngine{Type: "ssh", Paths: []SecretEnginePath{
+		{Path: "config/zeroaddress", Mode: WriteModeReplace, Data: map[string]interface{}{"roles": "otp,admin"}},
+		{Path: "roles/otp", Mode: WriteModeCreate, Data: map[string]interface{}{"key_type": "otp"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Change{
+		{Action: ActionDelete, Path: "ssh/config/zeroaddress"},
+		{Action: ActionCreate, Path: "ssh/config/zeroaddress"},
+		{Action: ActionCreate, Path: "ssh/roles/otp"},
+	}
+	if !reflect.DeepEqual(v.plan.Changes, expected) {
+		t.Errorf("expected %v, got %v", expected, v.plan.Changes)
+	}
+	if f.count("PUT", "ssh/config/zeroaddress") != 0 || f.count("DELETE", "ssh/config/zeroaddress") != 0 {
+		t.Error("expected nothing to be changed in plan mode")
+	}
+}
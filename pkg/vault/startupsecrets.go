@@ -0,0 +1,242 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	bankvaults "github.com/jacohend/bank-vaults/vault"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// The sources of the startup secret values besides literals, a value is read from a source if it is a
+// map with a single source key: an environment variable, a file, a bank-vaults key store key or a
+// Kubernetes Secret key given as {name: <secret>, key: <key>, namespace: <namespace>}
+const (
+	startupSecretEnvSource       = "env"
+	startupSecretFileSource      = "file"
+	startupSecretKVSource        = "kv"
+	startupSecretK8sSecretSource = "k8s_secret"
+)
+
+var startupSecretSources = []string{
+	startupSecretEnvSource, startupSecretFileSource, startupSecretKVSource, startupSecretK8sSecretSource,
+}
+
+// configureStartupSecrets writes the startup secrets to the KV secret engines, the secret engines
+// of the config are taken into account in plan mode, since they might not be mounted yet
+func (v *vault) configureStartupSecrets(startupSecrets []StartupSecret, secretEngines []SecretEngine) error {
+	if len(startupSecrets) == 0 {
+		return nil
+	}
+
+	mounts, err := v.cl.Sys().ListMounts()
+	if err != nil {
+		return fmt.Errorf("error reading mounts from vault: %s", err.Error())
+	}
+
+	for _, startupSecret := range startupSecrets {
+		err := v.configureStartupSecret(startupSecret, mounts, secretEngines)
+		if err != nil {
+			return fmt.Errorf("error writing %s startup secret: %s", startupSecret.Path, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (v *vault) configureStartupSecret(startupSecret StartupSecret, mounts map[string]*api.MountOutput, secretEngines []SecretEngine) error {
+	path := strings.Trim(startupSecret.Path, "/")
+	mountPath, version2, err := kvMount(path, mounts, secretEngines)
+	if err != nil {
+		return err
+	}
+
+	dataPath := path
+	if version2 {
+		dataPath = mountPath + "data/" + strings.TrimPrefix(path, mountPath)
+	} else if startupSecret.CAS != nil {
+		return fmt.Errorf("cas requires a KV version 2 secret engine, %s is version 1", mountPath)
+	}
+
+	existing, err := v.cl.Logical().Read(dataPath)
+	if err != nil {
+		return fmt.Errorf("error reading secret: %s", err.Error())
+	}
+
+	// deleted and destroyed KV version 2 secrets only have metadata
+	exists := existing != nil && existing.Data != nil
+	if version2 {
+		exists = exists && existing.Data["data"] != nil
+	}
+
+	if exists && !startupSecret.Overwrite {
+		logrus.Debugf("startup secret %s already exists, skipping it", path)
+		return nil
+	}
+
+	data := map[string]interface{}{}
+	for key, value := range startupSecret.Data {
+		data[key], err = v.startupSecretValue(value)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %s", key, err.Error())
+		}
+	}
+
+	// overwriting a KV version 2 secret with the same data would create a new version anyway
+	if exists {
+		existingData := existing.Data
+		if version2 {
+			existingData = cast.ToStringMap(existing.Data["data"])
+		}
+		if secretDataEqual(data, existingData) {
+			logrus.Debugf("startup secret %s is up to date, skipping it", path)
+			return nil
+		}
+	}
+
+	if version2 {
+		switch {
+		case startupSecret.CAS != nil:
+			data = bankvaults.NewData(*startupSecret.CAS, data)
+		case !startupSecret.Overwrite:
+			// the secret is only written if nobody created it in the meantime
+			data = bankvaults.NewData(kvCurrentVersion(existing), data)
+		default:
+			data = map[string]interface{}{"data": data}
+		}
+	}
+
+	logrus.Infof("writing startup secret %s", path)
+	return v.writeConfig(dataPath, data)
+}
+
+// secretDataEqual checks whether the secret holds exactly the data, the values are compared
+// after a JSON round trip, since Vault returns the numbers as json.Number
+func secretDataEqual(data, secret map[string]interface{}) bool {
+	normalizedData, err := jsonRoundTrip(data)
+	if err != nil {
+		return false
+	}
+	normalizedSecret, err := jsonRoundTrip(secret)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizedData, normalizedSecret)
+}
+
+func jsonRoundTrip(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var result interface{}
+	err = decoder.Decode(&result)
+	return result, err
+}
+
+// kvMount looks up the KV secret engine of the path, it returns the mount path (with a trailing slash)
+// and whether it is a KV version 2 secret engine
+func kvMount(path string, mounts map[string]*api.MountOutput, secretEngines []SecretEngine) (string, bool, error) {
+	types := map[string]string{}
+	versions := map[string]string{}
+	for _, secretEngine := range secretEngines {
+		mountPath := strings.Trim(secretEngine.MountPath(), "/") + "/"
+		types[mountPath] = secretEngine.Type
+		versions[mountPath] = cast.ToString(secretEngine.Options["version"])
+	}
+	for mountPath, mount := range mounts {
+		types[mountPath] = mount.Type
+		versions[mountPath] = mount.Options["version"]
+	}
+
+	// the longest mount path prefix wins
+	mountPaths := []string{}
+	for mountPath := range types {
+		if strings.HasPrefix(path, mountPath) && len(path) > len(mountPath) {
+			mountPaths = append(mountPaths, mountPath)
+		}
+	}
+	if len(mountPaths) == 0 {
+		return "", false, fmt.Errorf("no secret engine is mounted at the path")
+	}
+	sort.Slice(mountPaths, func(i, j int) bool { return len(mountPaths[i]) > len(mountPaths[j]) })
+
+	mountPath := mountPaths[0]
+	if types[mountPath] != "kv" && types[mountPath] != "generic" {
+		return "", false, fmt.Errorf("%s is a %s secret engine, not a KV one", mountPath, types[mountPath])
+	}
+	return mountPath, versions[mountPath] == "2", nil
+}
+
+// kvCurrentVersion returns the current version of a KV version 2 secret, or 0 if it doesn't exist
+func kvCurrentVersion(secret *api.Secret) int {
+	if secret == nil || secret.Data == nil {
+		return 0
+	}
+	metadata := cast.ToStringMap(secret.Data["metadata"])
+	return cast.ToInt(fmt.Sprint(metadata["version"]))
+}
+
+// startupSecretValue reads the value from its source, other values are returned as they are
+func (v *vault) startupSecretValue(value interface{}) (interface{}, error) {
+	source, ok := value.(map[string]interface{})
+	if !ok || !hasAnyField(source, startupSecretSources...) {
+		return value, nil
+	}
+
+	if name, ok := source[startupSecretEnvSource]; ok {
+		value, ok := os.LookupEnv(cast.ToString(name))
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+
+	if filename, ok := source[startupSecretFileSource]; ok {
+		content, err := ioutil.ReadFile(cast.ToString(filename))
+		if err != nil {
+			return nil, err
+		}
+		return string(content), nil
+	}
+
+	if key, ok := source[startupSecretKVSource]; ok {
+		value, err := v.keyStore.Get(cast.ToString(key))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from the key store: %s", key, err.Error())
+		}
+		return string(value), nil
+	}
+
+	ref := cast.ToStringMapString(source[startupSecretK8sSecretSource])
+	return kubernetesSecretValue(ref["namespace"], ref["name"], ref["key"])
+}
+
+// validateStartupSecretValue checks that a value read from a source has a single source
+func validateStartupSecretValue(value interface{}) error {
+	source, ok := value.(map[string]interface{})
+	if !ok || !hasAnyField(source, startupSecretSources...) {
+		return nil
+	}
+	if len(source) != 1 {
+		return fmt.Errorf("must have exactly one of %s", strings.Join(startupSecretSources, ", "))
+	}
+	if ref, ok := source[startupSecretK8sSecretSource]; ok {
+		ref := cast.ToStringMapString(ref)
+		if ref["name"] == "" || ref["key"] == "" {
+			return errors.New("must have the name and the key of the Kubernetes Secret")
+		}
+	}
+	return nil
+}
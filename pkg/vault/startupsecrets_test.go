@@ -0,0 +1,172 @@
+package vault
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cast"
+)
+
+func TestKVMount(t *testing.T) {
+	mounts := map[string]*api.MountOutput{
+		"secret/":     {Type: "kv", Options: map[string]string{"version": "2"}},
+		"secret/old/": {Type: "kv"},
+		"pki/":        {Type: "pki"},
+	}
+	secretEngines := []SecretEngine{
+		{Type: "kv", Path: "apps", Options: map[string]interface{}{"version": 2}},
+	}
+
+	tests := []struct {
+		path      string
+		mountPath string
+		version2  bool
+		err       bool
+	}{
+		{path: "secret/app/db", mountPath: "secret/", version2: true},
+		{path: "secret/old/db", mountPath: "secret/old/"},
+		{path: "apps/db", mountPath: "apps/", version2: true},
+		{path: "pki/db", err: true},
+		{path: "secret", err: true},
+		{path: "unknown/db", err: true},
+	}
+
+	for _, test := range tests {
+		mountPath, version2, err := kvMount(test.path, mounts, secretEngines)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected an error for %s", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", test.path, err.Error())
+			continue
+		}
+		if mountPath != test.mountPath || version2 != test.version2 {
+			t.Errorf("expected %s (version 2: %t) for %s, got %s (version 2: %t)", test.mountPath, test.version2, test.path, mountPath, version2)
+		}
+	}
+}
+
+func TestValidateStartupSecrets(t *testing.T) {
+	cas := 1
+	config := ExternalConfig{
+		StartupSecrets: []StartupSecret{
+			{Path: "secret/app", Data: map[string]interface{}{
+				"user":     "admin",
+				"password": map[string]interface{}{"env": "PASSWORD", "file": "/password"},
+				"token":    map[string]interface{}{"k8s_secret": map[string]interface{}{"name": "app"}},
+			}},
+			{Path: "secret/app", CAS: &cas, Data: map[string]interface{}{"user": "admin"}},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	for _, expected := range []string{
+		"startupSecrets[0].data.password must have exactly one of env, file, kv, k8s_secret",
+		"startupSecrets[0].data.token must have the name and the key of the Kubernetes Secret",
+		"startupSecrets[1].path is a duplicate",
+		"startupSecrets[1].cas is only allowed with overwrite",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error '%s' in: %s", expected, err.Error())
+		}
+	}
+}
+
+func TestSecretDataEqual(t *testing.T) {
+	secret := map[string]interface{}{
+		"ttl":     json.Number("3600"),
+		"hosts":   []interface{}{"a", "b"},
+		"comment": "",
+		"nested":  map[string]interface{}{"port": json.Number("8200")},
+	}
+
+	if !secretDataEqual(map[string]interface{}{
+		"ttl":     3600,
+		"hosts":   []string{"a", "b"},
+		"comment": "",
+		"nested":  map[string]interface{}{"port": 8200},
+	}, secret) {
+		t.Error("expected the same data to be equal")
+	}
+
+	// unlike the configuration of Vault, secret values aren't coerced
+	for _, data := range []map[string]interface{}{
+		{"ttl": "1h", "hosts": []string{"a", "b"}, "comment": "", "nested": map[string]interface{}{"port": 8200}},
+		{"ttl": 3600, "hosts": "a,b", "comment": "", "nested": map[string]interface{}{"port": 8200}},
+		{"ttl": 3600, "hosts": []string{"a", "b"}, "comment": nil, "nested": map[string]interface{}{"port": 8200}},
+		{"ttl": 3600, "hosts": []string{"a", "b"}, "comment": "", "nested": map[string]interface{}{"port": "8200"}},
+		{"ttl": 3600, "hosts": []string{"a", "b"}, "comment": ""},
+	} {
+		if secretDataEqual(data, secret) {
+			t.Errorf("expected %v to differ from %v", data, secret)
+		}
+	}
+}
+
+func TestConfigureStartupSecret(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	v := f.vault(newMemoryKV())
+
+	mounts := map[string]*api.MountOutput{
+		"secret/": {Type: "kv", Options: map[string]string{"version": "2"}},
+		"kv/":     {Type: "kv"},
+	}
+	os.Setenv("STARTUP_SECRET_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("STARTUP_SECRET_PASSWORD")
+
+	data := map[string]interface{}{
+		"user":     "admin",
+		"password": map[string]interface{}{"env": "STARTUP_SECRET_PASSWORD"},
+	}
+
+	// created with check-and-set, so that it isn't created twice
+	err := v.configureStartupSecret(StartupSecret{Path: "secret/app", Data: data}, mounts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := f.get("secret/data/app")
+	if cast.ToStringMap(written["data"])["password"] != "s3cr3t" || cast.ToInt(cast.ToStringMap(written["options"])["cas"]) != 0 {
+		t.Errorf("expected the secret to be created with cas 0, got %v", written)
+	}
+
+	// existing secrets aren't overwritten, and unchanged ones aren't written again
+	for _, overwrite := range []bool{false, true} {
+		err = v.configureStartupSecret(StartupSecret{Path: "secret/app", Overwrite: overwrite, Data: data}, mounts, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count := f.count("PUT", "secret/data/app"); count != 1 {
+		t.Errorf("expected the secret to be written once, got %d writes", count)
+	}
+
+	data["user"] = "root"
+	err = v.configureStartupSecret(StartupSecret{Path: "secret/app", Overwrite: true, Data: data}, mounts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written := f.get("secret/data/app"); cast.ToStringMap(written["data"])["user"] != "root" || written["options"] != nil {
+		t.Errorf("expected the secret to be overwritten without cas, got %v", written)
+	}
+
+	// KV version 1 secrets are compared as they are
+	f.set("kv/app", map[string]interface{}{"user": "root", "password": "s3cr3t"})
+	err = v.configureStartupSecret(StartupSecret{Path: "kv/app", Overwrite: true, Data: data}, mounts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := f.count("PUT", "kv/app"); count != 0 {
+		t.Errorf("expected the unchanged KV version 1 secret not to be written, got %d writes", count)
+	}
+}
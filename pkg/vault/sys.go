@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// configureSys applies the cluster-level settings, the ones which have drifted from the configuration are reported
+func (v *vault) configureSys(sys *SysConfig) error {
+	if sys == nil {
+		return nil
+	}
+
+	if sys.CORS != nil {
+		err := v.configureCORS(sys.CORS)
+		if err != nil {
+			return fmt.Errorf("error configuring CORS: %s", err.Error())
+		}
+	}
+
+	// the header names are canonicalized like Vault does, since the configuration keys are lowercased
+	uiHeaders := map[string][]string{}
+	for name, values := range sys.UIHeaders {
+		uiHeaders[http.CanonicalHeaderKey(name)] = values
+	}
+	names := make([]string, 0, len(uiHeaders))
+	for name := range uiHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := "sys/config/ui/headers/" + name
+		exists, actual, err := v.readConfig(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s UI header: %s", name, err.Error())
+		}
+		err = v.applySysConfig(path, map[string]interface{}{"values": uiHeaders[name]}, exists, actual)
+		if err != nil {
+			return fmt.Errorf("error configuring %s UI header: %s", name, err.Error())
+		}
+	}
+
+	for _, header := range sys.AuditRequestHeaders {
+		path := "sys/config/auditing/request-headers/" + header.Name
+		exists, data, err := v.readConfig(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s audit request header: %s", header.Name, err.Error())
+		}
+		// the settings of the header are returned under its (lower case) name
+		actual := map[string]interface{}{}
+		for _, settings := range data {
+			actual = cast.ToStringMap(settings)
+		}
+		err = v.applySysConfig(path, map[string]interface{}{"hmac": header.HMAC}, exists, actual)
+		if err != nil {
+			return fmt.Errorf("error configuring %s audit request header: %s", header.Name, err.Error())
+		}
+	}
+
+	paths := make([]string, 0, len(sys.Mounts))
+	for path := range sys.Mounts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		tunePath := fmt.Sprintf("sys/mounts/%s/tune", strings.Trim(path, "/"))
+		exists, actual, err := v.readConfig(tunePath)
+		if err != nil {
+			return fmt.Errorf("error reading tuning of %s: %s", path, err.Error())
+		}
+		if !exists {
+			return fmt.Errorf("error tuning %s: it isn't mounted", path)
+		}
+		err = v.applySysConfig(tunePath, mountTuneConfig("", sys.Mounts[path], nil), exists, actual)
+		if err != nil {
+			return fmt.Errorf("error tuning %s: %s", path, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// configureCORS writes the CORS configuration, or deletes it if CORS isn't enabled
+func (v *vault) configureCORS(cors *CORSConfig) error {
+	const path = "sys/config/cors"
+	exists, actual, err := v.readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	if !cors.Enabled {
+		if exists && cast.ToBool(actual["enabled"]) {
+			logrus.Warnf("%s has drifted from the configuration (enabled), disabling CORS", path)
+			return v.deleteConfig(path)
+		}
+		return nil
+	}
+
+	desired := map[string]interface{}{
+		"enabled":         true,
+		"allowed_origins": cors.AllowedOrigins,
+	}
+	if len(cors.AllowedHeaders) > 0 {
+		desired["allowed_headers"] = cors.AllowedHeaders
+	}
+	return v.applySysConfig(path, desired, exists, actual)
+}
+
+// applySysConfig writes the setting if it doesn't exist yet or has drifted from the
+// configuration, in plan mode it records the change instead
+func (v *vault) applySysConfig(path string, desired map[string]interface{}, exists bool, actual map[string]interface{}) error {
+	if exists {
+		fields := changedFields(desired, actual)
+		if len(fields) == 0 {
+			return nil
+		}
+		if v.plan != nil {
+			v.plan.add(ActionUpdate, path, fields...)
+			return nil
+		}
+		logrus.Warnf("%s has drifted from the configuration (%s), updating it", path, strings.Join(fields, ", "))
+	} else if v.plan != nil {
+		v.plan.add(ActionCreate, path)
+		return nil
+	}
+
+	_, err := v.cl.Logical().Write(path, desired)
+	return err
+}
@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestApplySysConfigPlan(t *testing.T) {
+	v := &vault{plan: &Plan{}}
+	actual := map[string]interface{}{
+		"default_lease_ttl": json.Number("3600"),
+		"max_lease_ttl":     json.Number("86400"),
+	}
+
+	err := v.applySysConfig("sys/mounts/cubbyhole/tune", map[string]interface{}{"default_lease_ttl": "1h"}, true, actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.plan.Empty() {
+		t.Errorf("expected no changes, got %v", v.plan.Changes)
+	}
+
+	err = v.applySysConfig("sys/mounts/cubbyhole/tune", map[string]interface{}{"default_lease_ttl": "1h", "max_lease_ttl": "48h"}, true, actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.applySysConfig("sys/config/ui/headers/X-Custom", map[string]interface{}{"values": []string{"value"}}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Change{
+		{Action: ActionUpdate, Path: "sys/mounts/cubbyhole/tune", Fields: []string{"max_lease_ttl"}},
+		{Action: ActionCreate, Path: "sys/config/ui/headers/X-Custom"},
+	}
+	if len(v.plan.Changes) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, v.plan.Changes)
+	}
+	for i, change := range v.plan.Changes {
+		if change.Action != expected[i].Action || change.Path != expected[i].Path ||
+			strings.Join(change.Fields, ",") != strings.Join(expected[i].Fields, ",") {
+			t.Errorf("expected %v, got %v", expected[i], change)
+		}
+	}
+}
+
+func TestValidateSys(t *testing.T) {
+	config := ExternalConfig{
+		Secrets: []SecretEngine{{Type: "kv", Path: "secret"}},
+		Sys: &SysConfig{
+			CORS:      &CORSConfig{Enabled: true},
+			UIHeaders: map[string][]string{"X-Custom": nil},
+			AuditRequestHeaders: []AuditRequestHeader{
+				{Name: "X-Forwarded-For"},
+				{Name: "x-forwarded-for", HMAC: true},
+				{HMAC: true},
+			},
+			Mounts: map[string]MountTuning{
+				"cubbyhole": {DefaultLeaseTTL: "1h"},
+				"secret/":   {MaxLeaseTTL: "24h"},
+				"sys":       {},
+			},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"sys.cors.allowed_origins missing",
+		"sys.ui_headers.X-Custom values missing",
+		"sys.audit_request_headers[1].name is a duplicate",
+		"sys.audit_request_headers[2].name missing",
+		"sys.mounts.secret/ is a secret engine of the configuration",
+		"sys.mounts.sys tuning missing",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %s", expected, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "cubbyhole") {
+		t.Errorf("expected the cubbyhole tuning to be valid, got %s", err.Error())
+	}
+}
+
+func TestConfigureSys(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	v := f.vault(newMemoryKV())
+
+	sys := &SysConfig{
+		CORS: &CORSConfig{Enabled: true, AllowedOrigins: []string{"https://example.com"}},
+		// viper lowercases the keys of the configuration
+		UIHeaders: map[string][]string{"x-custom": {"value"}},
+	}
+
+	// the settings are written once, while they don't drift
+	for i := 0; i < 2; i++ {
+		if err := v.configureSys(sys); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.count("PUT", "sys/config/cors") != 1 || f.count("PUT", "sys/config/ui/headers/X-Custom") != 1 {
+		t.Errorf("expected the settings to be written once, got %v", f.requests)
+	}
+
+	// drifted settings are written again
+	f.set("sys/config/cors", map[string]interface{}{"enabled": true, "allowed_origins": []interface{}{"*"}})
+	if err := v.configureSys(sys); err != nil {
+		t.Fatal(err)
+	}
+	if f.count("PUT", "sys/config/cors") != 2 {
+		t.Errorf("expected the drifted CORS configuration to be written, got %v", f.requests)
+	}
+
+	// disabling CORS deletes its configuration
+	sys.CORS.Enabled = false
+	if err := v.configureSys(sys); err != nil {
+		t.Fatal(err)
+	}
+	if f.get("sys/config/cors") != nil {
+		t.Errorf("expected the CORS configuration to be deleted, got %v", f.get("sys/config/cors"))
+	}
+
+	// mounts have to exist to be tuned
+	sys.Mounts = map[string]MountTuning{"secret": {}}
+	if err := v.configureSys(sys); err == nil || !strings.Contains(err.Error(), "it isn't mounted") {
+		t.Errorf("expected a not mounted error, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/jacohend/bank-vaults/pkg/kv"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// tokenKeyPrefix is the prefix of the key store keys recording the accessors of the created tokens
+const tokenKeyPrefix = "vault-token-"
+
+// configureTokenRoles writes the token roles to auth/token/roles/<name>
+func (v *vault) configureTokenRoles(roles []map[string]interface{}) error {
+	for _, role := range roles {
+		name := cast.ToString(role["name"])
+		data := map[string]interface{}{}
+		for key, value := range role {
+			if key != "name" {
+				data[key] = value
+			}
+		}
+
+		err := v.writeConfig("auth/token/roles/"+name, data)
+		if err != nil {
+			return fmt.Errorf("error putting %s token role into vault: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// configureTokens creates the tokens which haven't been created yet or are no longer valid
+// and delivers them, token roles have to be configured before
+func (v *vault) configureTokens(tokens []Token) error {
+	for _, token := range tokens {
+		err := v.configureToken(token)
+		if err != nil {
+			return fmt.Errorf("error creating %s token: %s", token.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (v *vault) configureToken(token Token) error {
+	recordKey := tokenKeyPrefix + token.Name
+
+	valid, err := v.tokenValid(recordKey)
+	if err != nil || valid {
+		return err
+	}
+
+	createPath := "auth/token/create"
+	if token.Role != "" {
+		createPath += "/" + token.Role
+	} else if token.Orphan {
+		createPath += "-orphan"
+	}
+
+	if v.plan != nil {
+		v.plan.add(ActionCreate, createPath)
+		return nil
+	}
+
+	request := &api.TokenCreateRequest{
+		ID:              token.ID,
+		Policies:        token.Policies,
+		NoDefaultPolicy: token.NoDefaultPolicy,
+		Metadata:        token.Metadata,
+		DisplayName:     token.DisplayName,
+		TTL:             token.TTL,
+		ExplicitMaxTTL:  token.ExplicitMaxTTL,
+		Period:          token.Period,
+	}
+
+	logrus.Infof("creating %s token with %s", token.Name, createPath)
+	var secret *api.Secret
+	switch {
+	case token.Role != "":
+		secret, err = v.cl.Auth().Token().CreateWithRole(request, token.Role)
+	case token.Orphan:
+		secret, err = v.cl.Auth().Token().CreateOrphan(request)
+	default:
+		secret, err = v.cl.Auth().Token().Create(request)
+	}
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Auth == nil {
+		return fmt.Errorf("no token returned")
+	}
+
+	// the accessor is recorded before the delivery, so that key stores which don't keep it (e.g. the dev
+	// one) are refused, and the token is revoked if it can't be recorded or delivered, instead of left untracked
+	accessor := secret.Auth.Accessor
+	err = v.keepRecord(recordKey, []byte(accessor))
+	if err != nil {
+		err = fmt.Errorf("error recording token accessor in key store: %s", err.Error())
+	} else {
+		err = v.deliverToken(token, secret.Auth.ClientToken, accessor)
+	}
+	if err != nil {
+		if revokeErr := v.cl.Auth().Token().RevokeAccessor(accessor); revokeErr != nil {
+			logrus.Warnf("error revoking the undelivered %s token: %s", token.Name, revokeErr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// tokenValid checks whether the token with the accessor recorded in the key store is still valid
+func (v *vault) tokenValid(recordKey string) (bool, error) {
+	accessor, err := v.keyStore.Get(recordKey)
+	if _, ok := err.(*kv.NotFoundError); ok {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error reading %s from key store: %s", recordKey, err.Error())
+	}
+	if len(accessor) == 0 {
+		return false, nil
+	}
+
+	_, err = v.cl.Auth().Token().LookupAccessor(string(accessor))
+	if err != nil && isClientError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error looking up token accessor: %s", err.Error())
+	}
+	return true, nil
+}
+
+// deliverToken writes the token to a file and the token and its accessor to a Kubernetes Secret and/or the key store
+func (v *vault) deliverToken(token Token, clientToken, accessor string) error {
+	if token.File != "" {
+		err := writeOutputFile(token.File, []byte(clientToken), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	delivered := map[string][]byte{
+		"token":    []byte(clientToken),
+		"accessor": []byte(accessor),
+	}
+
+	if token.K8sSecret != nil {
+		err := writeKubernetesSecret(token.K8sSecret.Namespace, token.K8sSecret.Name, delivered)
+		if err != nil {
+			return err
+		}
+	}
+
+	if token.KV != "" {
+		for key, value := range delivered {
+			err := v.writeOutputKV(token.KV+"-"+strings.Replace(key, "_", "-", -1), value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
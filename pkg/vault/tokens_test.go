@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateTokens(t *testing.T) {
+	config := ExternalConfig{
+		TokenRoles: []map[string]interface{}{
+			{"name": "service", "allowed_policies": "allow_secrets", "period": "24h"},
+			{"allowed_policies": "allow_secrets"},
+			{"name": "service"},
+		},
+		Tokens: []Token{
+			{Name: "ci", Role: "service", KV: "vault-ci"},
+			{Name: "ci", File: "/tmp/token"},
+			{Name: "batch", Orphan: true, Role: "service", K8sSecret: &KubernetesSecretRef{}, Period: "1 day"},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, expected := range []string{
+		"tokenRoles[1].name missing",
+		"tokenRoles[2].name is a duplicate",
+		"tokens[1].name is a duplicate",
+		"tokens[2].k8s_secret.name missing",
+		"tokens[2] can't have both role and orphan",
+		"tokens[2].period is invalid",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %s", expected, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "tokens[0]") || strings.Contains(err.Error(), "tokenRoles[0]") {
+		t.Errorf("expected the first token and token role to be valid, got %s", err.Error())
+	}
+}
+
+func TestConfigureToken(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	store := newMemoryKV()
+	v := f.vault(store)
+
+	created := 0
+	f.handle("PUT", "auth/token/create/service", func(body map[string]interface{}) (int, interface{}) {
+		created++
+		if body["display_name"] != "ci" {
+			t.Errorf("unexpected token create request: %v", body)
+		}
+		return http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": fmt.Sprintf("token-%d", created),
+			"accessor":     fmt.Sprintf("accessor-%d", created),
+		}}
+	})
+	revoked := map[string]bool{}
+	f.handle("PUT", "auth/token/lookup-accessor", func(body map[string]interface{}) (int, interface{}) {
+		if revoked[body["accessor"].(string)] {
+			return http.StatusBadRequest, map[string]interface{}{"errors": []string{"invalid accessor"}}
+		}
+		return http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"accessor": body["accessor"]}}
+	})
+
+	token := Token{Name: "ci", Role: "service", DisplayName: "ci", KV: "vault-ci"}
+
+	// the token is created and delivered once, while it's valid
+	for i := 0; i < 2; i++ {
+		if err := v.configureToken(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("expected the token to be created once, got %d", created)
+	}
+	if string(store.data["vault-ci-token"]) != "token-1" || string(store.data["vault-ci-accessor"]) != "accessor-1" {
+		t.Errorf("expected the token to be delivered, got %v", store.data)
+	}
+	if string(store.data["vault-token-ci"]) != "accessor-1" {
+		t.Errorf("expected the accessor to be recorded, got '%s'", store.data["vault-token-ci"])
+	}
+
+	// plan mode records the creation of the revoked token without creating it
+	revoked["accessor-1"] = true
+	v.plan = &Plan{}
+	if err := v.configureToken(token); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || len(v.plan.Changes) != 1 || v.plan.Changes[0].Path != "auth/token/create/service" {
+		t.Errorf("expected the token creation to be planned, got %v", v.plan.Changes)
+	}
+
+	// the revoked token is recreated and delivered again
+	v.plan = nil
+	if err := v.configureToken(token); err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 || string(store.data["vault-ci-token"]) != "token-2" || string(store.data["vault-token-ci"]) != "accessor-2" {
+		t.Errorf("expected the revoked token to be recreated, got %v", store.data)
+	}
+}
+
+func TestConfigureTokenRevokesUndeliveredTokens(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	v := f.vault(newMemoryKV())
+
+	f.handle("PUT", "auth/token/create", func(map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{"client_token": "token", "accessor": "accessor"}}
+	})
+	revoked := []interface{}{}
+	f.handle("PUT", "auth/token/revoke-accessor", func(body map[string]interface{}) (int, interface{}) {
+		revoked = append(revoked, body["accessor"])
+		return http.StatusNoContent, nil
+	})
+
+	// the token can't be delivered to the file
+	err := v.configureToken(Token{Name: "ci", File: "/nonexistent/token"})
+	if err == nil || len(revoked) != 1 || revoked[0] != "accessor" {
+		t.Errorf("expected the undelivered token to be revoked, got %v, %v", err, revoked)
+	}
+
+	// the key store doesn't keep the accessor, so the token would be created again on every run
+	v.keyStore = discardKV{}
+	err = v.configureToken(Token{Name: "ci", KV: "vault-ci"})
+	if err == nil || !strings.Contains(err.Error(), "doesn't keep the records") || len(revoked) != 2 {
+		t.Errorf("expected the key store to be refused and the token to be revoked, got %v, %v", err, revoked)
+	}
+}
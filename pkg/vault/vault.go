@@ -1,24 +1,33 @@
 package vault
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/jacohend/bank-vaults/pkg/kv"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
-	"github.com/spf13/viper"
 )
 
 // DefaultConfigFile is the name of the default config file
 const DefaultConfigFile = "vault-config.yml"
 
+// sealLockKey is the key store key of the seal lock
+const sealLockKey = "vault-seal-lock"
+
+// sealUnlocked is the value of a cleared seal lock, since kv.Service has no delete
+// and some key stores (e.g. AWS KMS) can't store empty values
+const sealUnlocked = "unlocked"
+
 // Config holds the configuration of the Vault initialization
 type Config struct {
 	// how many key parts exist
@@ -38,6 +47,8 @@ type vault struct {
 	keyStore kv.Service
 	cl       *api.Client
 	config   *Config
+	// plan collects the changes instead of making them, if set
+	plan *Plan
 }
 
 // Interface check
@@ -48,8 +59,11 @@ var _ Vault = &vault{}
 type Vault interface {
 	Sealed() (bool, error)
 	Unseal() error
+	Seal() error
 	Init() error
-	Configure() error
+	KeyStoreStatus(shares int) []KeyStatus
+	Configure(config *ExternalConfig) error
+	Plan(config *ExternalConfig) (*Plan, error)
 }
 
 // New returns a new vault Vault, or an error.
@@ -75,39 +89,333 @@ func (v *vault) Sealed() (bool, error) {
 }
 
 // Unseal will attempt to unseal vault by retrieving keys from the kms service
-// and sending unseal requests to vault. It will return an error if retrieving
-// a key fails, or if the unseal progress is reset to 0 (indicating that a key)
-// was invalid.
+// and sending unseal requests to vault. Keys are retrieved in parallel, keys
+// which are missing or fail to be retrieved (e.g. can't be decrypted) are skipped.
+// If vault rejects a key or fails to unseal with the submitted keys, the unseal
+// progress is reset and another subset of the keys is tried. It will return an
+// error listing the unusable keys if none of the subsets unseal vault.
 func (v *vault) Unseal() error {
 	defer runtime.GC()
-	for i := 0; ; i++ {
-		keyID := v.unsealKeyForID(i)
 
-		logrus.Debugf("retrieving key from kms service...")
-		k, err := v.keyStore.Get(keyID)
+	status, err := v.cl.Sys().SealStatus()
+	if err != nil {
+		return fmt.Errorf("error checking status: %s", err.Error())
+	}
+
+	if !status.Sealed {
+		return nil
+	}
+
+	// a previous attempt might have left some progress behind with an invalid key
+	if status.Progress > 0 {
+		if err := v.resetUnseal(); err != nil {
+			return err
+		}
+	}
+
+	// unusable holds the reason why a key can't be used to unseal vault
+	unusable := map[string]string{}
+	keys := []unsealKey{}
+	for _, key := range v.retrieveUnsealKeys(status.N) {
+		if key.err != nil {
+			logrus.Warnf("unable to get key '%s': %s", key.id, key.err.Error())
+			unusable[key.id] = key.err.Error()
+			continue
+		}
+		keys = append(keys, key)
+	}
+	// erase the keys from memory once they aren't needed anymore
+	defer func() {
+		for _, key := range keys {
+			for i := range key.key {
+				key.key[i] = 0
+			}
+		}
+	}()
+
+	// suspects are the keys of subsets which failed to unseal vault
+	suspects := map[string]bool{}
+	unsealed := false
 
+	combinations(len(keys), status.T, func(subset []int) bool {
+		subsetKeys := []unsealKey{}
+		for _, i := range subset {
+			if _, ok := unusable[keys[i].id]; ok {
+				break
+			}
+			subsetKeys = append(subsetKeys, keys[i])
+		}
+		if len(subsetKeys) < status.T {
+			return true
+		}
+
+		var sealed bool
+		var rejected string
+		sealed, rejected, err = v.unsealWithKeys(subsetKeys)
 		if err != nil {
-			return fmt.Errorf("unable to get key '%s': %s", keyID, err.Error())
+			return false
+		}
+
+		if !sealed {
+			for _, key := range subsetKeys {
+				delete(suspects, key.id)
+			}
+			unsealed = true
+			return false
+		}
+
+		if rejected != "" {
+			logrus.Warnf("key '%s' was rejected by vault", rejected)
+			unusable[rejected] = "rejected by vault"
+		} else {
+			for _, key := range subsetKeys {
+				suspects[key.id] = true
+			}
+		}
+
+		logrus.Warnf("failed to unseal vault with keys %s, trying another subset of the keys...", unsealKeyIDs(subsetKeys))
+		err = v.resetUnseal()
+		return err == nil
+	})
+
+	if err != nil {
+		return err
+	}
+	if unsealed {
+		if len(unusable) > 0 || len(suspects) > 0 {
+			logrus.Warnf("vault unsealed, but some keys are unusable: %s", describeUnusableKeys(unusable, suspects))
 		}
+		return nil
+	}
+
+	return fmt.Errorf("failed to unseal vault with the available keys: %s", describeUnusableKeys(unusable, suspects))
+}
+
+// unsealKey is an unseal key (or the error of retrieving it) from the key store
+type unsealKey struct {
+	id  string
+	key []byte
+	err error
+}
+
+// retrieveUnsealKeys retrieves the given number of unseal keys from the key store in parallel
+func (v *vault) retrieveUnsealKeys(shares int) []unsealKey {
+	keys := make([]unsealKey, shares)
+
+	var wg sync.WaitGroup
+	for i := 0; i < shares; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keyID := v.unsealKeyForID(i)
+			logrus.Debugf("retrieving key '%s' from kms service...", keyID)
+			k, err := v.keyStore.Get(keyID)
+			keys[i] = unsealKey{id: keyID, key: k, err: err}
+		}(i)
+	}
+	wg.Wait()
+
+	return keys
+}
+
+// unsealWithKeys sends unseal requests to vault with the keys until vault gets unsealed.
+// It returns the ID of the key if vault rejected a single key before reaching the threshold,
+// and an error only if the request couldn't be sent.
+func (v *vault) unsealWithKeys(keys []unsealKey) (sealed bool, rejected string, err error) {
+	for i, key := range keys {
+		last := i == len(keys)-1
 
 		logrus.Debugf("sending unseal request to vault...")
-		resp, err := v.cl.Sys().Unseal(string(k))
+		resp, err := v.cl.Sys().Unseal(string(key.key))
 
 		if err != nil {
-			return fmt.Errorf("fail to send unseal request to vault: %s", err.Error())
+			if !isKeyRejectedError(err) {
+				return true, "", fmt.Errorf("fail to send unseal request to vault: %s", err.Error())
+			}
+			if !last {
+				return true, key.id, nil
+			}
+			return true, "", nil
 		}
 
 		logrus.Debugf("got unseal response: %+v", *resp)
 
 		if !resp.Sealed {
-			return nil
+			return false, "", nil
 		}
 
-		// if progress is 0, we failed to unseal vault.
+		// if progress is reset to 0, the key (or the combination of the keys) was invalid
 		if resp.Progress == 0 {
-			return fmt.Errorf("failed to unseal vault. progress reset to 0")
+			if !last {
+				return true, key.id, nil
+			}
+			return true, "", nil
 		}
 	}
+	return true, "", nil
+}
+
+func (v *vault) resetUnseal() error {
+	logrus.Debugf("resetting unseal progress...")
+	_, err := v.cl.Sys().ResetUnsealProcess()
+	if err != nil {
+		return fmt.Errorf("fail to reset unseal progress: %s", err.Error())
+	}
+	return nil
+}
+
+func unsealKeyIDs(keys []unsealKey) string {
+	ids := []string{}
+	for _, key := range keys {
+		ids = append(ids, key.id)
+	}
+	return strings.Join(ids, ", ")
+}
+
+func describeUnusableKeys(unusable map[string]string, suspects map[string]bool) string {
+	descriptions := []string{}
+	for id, reason := range unusable {
+		descriptions = append(descriptions, fmt.Sprintf("'%s' (%s)", id, reason))
+	}
+	for id := range suspects {
+		descriptions = append(descriptions, fmt.Sprintf("'%s' (possibly corrupt)", id))
+	}
+	if len(descriptions) == 0 {
+		return "no unusable keys found"
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ", ")
+}
+
+// combinations calls fn with the k element subsets of the first n integers in lexicographic order until
+// fn returns false, the subsets are generated one by one, since their number grows exponentially with n
+func combinations(n, k int, fn func(subset []int) bool) {
+	if k <= 0 || k > n {
+		return
+	}
+
+	subset := make([]int, k)
+	for i := range subset {
+		subset[i] = i
+	}
+
+	for {
+		if !fn(append([]int{}, subset...)) {
+			return
+		}
+
+		// find the rightmost element which can be incremented
+		i := k - 1
+		for i >= 0 && subset[i] == n-k+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+
+		subset[i]++
+		for j := i + 1; j < k; j++ {
+			subset[j] = subset[j-1] + 1
+		}
+	}
+}
+
+// Seal seals vault, if the client has no token set, the root token is retrieved from the kms service
+func (v *vault) Seal() error {
+	if v.cl.Token() == "" {
+		logrus.Debugf("retrieving key from kms service...")
+
+		rootToken, err := v.keyStore.Get(v.rootTokenKey())
+		if err != nil {
+			return fmt.Errorf("unable to get key '%s': %s", v.rootTokenKey(), err.Error())
+		}
+
+		v.cl.SetToken(string(rootToken))
+
+		// Clear the token and GC it
+		defer runtime.GC()
+		defer v.cl.SetToken("")
+		defer func() { rootToken = nil }()
+	}
+
+	if err := v.cl.Sys().Seal(); err != nil {
+		return fmt.Errorf("error sealing vault: %s", err.Error())
+	}
+	return nil
+}
+
+// LockSeal stores a seal lock with the reason of sealing in the key store,
+// bank-vaults doesn't unseal vault automatically while the lock is present
+func LockSeal(store kv.Service, reason string) error {
+	lock := fmt.Sprintf("%s: %s", time.Now().UTC().Format(time.RFC3339), reason)
+	if err := store.Set(sealLockKey, []byte(lock)); err != nil {
+		return fmt.Errorf("error storing seal lock: %s", err.Error())
+	}
+
+	// some key stores (e.g. the dev one) don't store anything besides the root token
+	stored, err := SealLock(store)
+	if err != nil {
+		return err
+	}
+	if stored != lock {
+		return errors.New("error storing seal lock: the key store doesn't keep it")
+	}
+	return nil
+}
+
+// SealLock returns the seal lock from the key store, or an empty string if vault is not locked
+func SealLock(store kv.Service) (string, error) {
+	lock, err := store.Get(sealLockKey)
+	if _, ok := err.(*kv.NotFoundError); ok {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error checking seal lock: %s", err.Error())
+	}
+	if string(lock) == sealUnlocked {
+		return "", nil
+	}
+	return string(lock), nil
+}
+
+// ClearSealLock removes the seal lock, so that vault can be unsealed automatically again
+func ClearSealLock(store kv.Service) error {
+	lock, err := SealLock(store)
+	if err != nil || lock == "" {
+		return err
+	}
+	if err := store.Set(sealLockKey, []byte(sealUnlocked)); err != nil {
+		return fmt.Errorf("error clearing seal lock: %s", err.Error())
+	}
+	return nil
+}
+
+// KeyStatus tells if a key managed by bank-vaults is present in the key store
+type KeyStatus struct {
+	Key    string `json:"key"`
+	Exists bool   `json:"exists"`
+	Error  string `json:"error,omitempty"`
+}
+
+// KeyStoreStatus checks which of the given number of unseal keys and the root token are present in the key store,
+// without decrypting them if the key store supports it
+func (v *vault) KeyStoreStatus(shares int) []KeyStatus {
+	keys := []string{v.rootTokenKey()}
+	for i := 0; i < shares; i++ {
+		keys = append(keys, v.unsealKeyForID(i))
+	}
+
+	statuses := []KeyStatus{}
+	for _, key := range keys {
+		status := KeyStatus{Key: key}
+		exists, err := kv.Exists(v.keyStore, key)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		status.Exists = exists
+		statuses = append(statuses, status)
+	}
+
+	return statuses
 }
 
 func (v *vault) keyStoreNotFound(key string) (bool, error) {
@@ -129,6 +437,20 @@ func (v *vault) keyStoreSet(key string, val []byte) error {
 	}
 }
 
+// keepRecord stores a record of bank-vaults in the key store and reads it back, since some key stores
+// (e.g. the dev one) don't keep anything besides the root token, and the recorded actions would be repeated
+func (v *vault) keepRecord(key string, value []byte) error {
+	err := v.keyStore.Set(key, value)
+	if err != nil {
+		return err
+	}
+	stored, err := v.keyStore.Get(key)
+	if _, ok := err.(*kv.NotFoundError); ok || (err == nil && !bytes.Equal(stored, value)) {
+		return errors.New("the key store doesn't keep the records of bank-vaults, use another key store")
+	}
+	return err
+}
+
 // Init initializes Vault if is not initialized already
 func (v *vault) Init() error {
 	initialized, err := v.cl.Sys().InitStatus()
@@ -249,7 +571,7 @@ func (v *vault) Init() error {
 	return nil
 }
 
-func (v *vault) Configure() error {
+func (v *vault) Configure(config *ExternalConfig) error {
 	logrus.Debugf("retrieving key from kms service...")
 
 	rootToken, err := v.keyStore.Get(v.rootTokenKey())
@@ -264,93 +586,72 @@ func (v *vault) Configure() error {
 	defer v.cl.SetToken("")
 	defer func() { rootToken = nil }()
 
-	existingAuths, err := v.cl.Sys().ListAuth()
+	// audit devices come first, so that the rest of the configuration is audited
+	err = v.configureAuditDevices(config.Audit)
+	if err != nil {
+		return fmt.Errorf("error configuring audit devices for vault: %s", err.Error())
+	}
 
+	err = v.configureSys(config.Sys)
 	if err != nil {
-		return fmt.Errorf("error listing auth backends vault: %s", err.Error())
+		return fmt.Errorf("error configuring system settings for vault: %s", err.Error())
 	}
 
-	authMethods := []map[string]interface{}{}
-	err = viper.UnmarshalKey("auth", &authMethods)
+	// plugins have to be registered before they are mounted
+	err = v.configurePlugins(config.Plugins)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling vault auth methods config: %s", err.Error())
+		return fmt.Errorf("error configuring plugins for vault: %s", err.Error())
 	}
-	for _, authMethod := range authMethods {
-		authMethodType := authMethod["type"].(string)
 
-		path := authMethodType
-		if pathOverwrite, ok := authMethod["path"]; ok {
-			path = pathOverwrite.(string)
-		}
+	err = v.configureAuthMethods(config.Auth)
+	if err != nil {
+		return fmt.Errorf("error configuring auth methods for vault: %s", err.Error())
+	}
 
-		// Check and skip existing auth mounts
-		exists := false
-		if authMount, ok := existingAuths[path+"/"]; ok {
-			if authMount.Type == authMethodType {
-				logrus.Debugf("%s auth backend is already mounted in vault", authMethodType)
-				exists = true
-			}
-		}
+	err = v.configurePolicies(config.Policies)
+	if err != nil {
+		return fmt.Errorf("error configuring policies for vault: %s", err.Error())
+	}
 
-		if !exists {
-			logrus.Debugf("enabling %s auth backend in vault...", authMethodType)
+	err = v.configureTokenRoles(config.TokenRoles)
+	if err != nil {
+		return fmt.Errorf("error configuring token roles for vault: %s", err.Error())
+	}
 
-			// https://www.vaultproject.io/api/system/auth.html
-			options := api.EnableAuthOptions{
-				Type: authMethodType,
-			}
+	err = v.configureIdentity(config.Identity)
+	if err != nil {
+		return fmt.Errorf("error configuring identity for vault: %s", err.Error())
+	}
 
-			err := v.cl.Sys().EnableAuthWithOptions(path, &options)
+	err = v.configureSecretEngines(config.Secrets)
+	if err != nil {
+		return fmt.Errorf("error configuring secret engines for vault: %s", err.Error())
+	}
 
-			if err != nil {
-				return fmt.Errorf("error enabling %s auth method for vault: %s", authMethodType, err.Error())
-			}
-		}
+	err = v.warnRemovedSecretEngines(config)
+	if err != nil {
+		return fmt.Errorf("error checking removed secret engines in vault: %s", err.Error())
+	}
 
-		switch authMethodType {
-		case "kubernetes":
-			err = v.kubernetesAuthConfig(path)
-			if err != nil {
-				return fmt.Errorf("error configuring kubernetes auth for vault: %s", err.Error())
-			}
-			roles := authMethod["roles"].([]interface{})
-			err = v.configureKubernetesRoles(roles)
-			if err != nil {
-				return fmt.Errorf("error configuring kubernetes auth roles for vault: %s", err.Error())
-			}
-		case "github":
-			config := cast.ToStringMap(authMethod["config"])
-			err = v.configureGithubConfig(config)
-			if err != nil {
-				return fmt.Errorf("error configuring github auth for vault: %s", err.Error())
-			}
-			mappings := cast.ToStringMap(authMethod["map"])
-			err = v.configureGithubMappings(mappings)
-			if err != nil {
-				return fmt.Errorf("error configuring github mappings for vault: %s", err.Error())
-			}
-		case "aws":
-			config := cast.ToStringMap(authMethod["config"])
-			err = v.configureAwsConfig(config)
-			if err != nil {
-				return fmt.Errorf("error configuring aws auth for vault: %s", err.Error())
-			}
-			roles := authMethod["roles"].([]interface{})
-			err = v.configureAwsRoles(roles)
-			if err != nil {
-				return fmt.Errorf("error configuring aws auth roles for vault: %s", err.Error())
-			}
-		}
+	err = v.configureStartupSecrets(config.StartupSecrets, config.Secrets)
+	if err != nil {
+		return fmt.Errorf("error configuring startup secrets for vault: %s", err.Error())
 	}
 
-	err = v.configurePolicies()
+	err = v.configureTokens(config.Tokens)
 	if err != nil {
-		return fmt.Errorf("error configuring policies for vault: %s", err.Error())
+		return fmt.Errorf("error creating tokens in vault: %s", err.Error())
 	}
 
-	err = v.configureSecretEngines()
+	err = v.purgeUnmanagedConfig(config)
 	if err != nil {
-		return fmt.Errorf("error configuring secret engines for vault: %s", err.Error())
+		return fmt.Errorf("error purging unmanaged configuration from vault: %s", err.Error())
+	}
+
+	// outputs come last, so that they reflect the configured state
+	err = v.configureOutputs(config.Outputs)
+	if err != nil {
+		return fmt.Errorf("error exporting outputs of vault: %s", err.Error())
 	}
 
 	return err
@@ -368,127 +669,248 @@ func (*vault) testKey() string {
 	return fmt.Sprint("vault-test")
 }
 
-func (v *vault) kubernetesAuthConfig(path string) error {
-	kubernetesCACert, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/ca.crt")
-	if err != nil {
-		return err
-	}
-	tokenReviewerJWT, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
-	if err != nil {
-		return err
-	}
-	config := map[string]interface{}{
-		"kubernetes_host":    fmt.Sprint("https://", os.Getenv("KUBERNETES_SERVICE_HOST")),
-		"kubernetes_ca_cert": string(kubernetesCACert),
-		"token_reviewer_jwt": string(tokenReviewerJWT),
-	}
-	_, err = v.cl.Logical().Write(fmt.Sprintf("auth/%s/config", path), config)
-	return err
-}
+func (v *vault) configureAuthMethods(authMethods []AuthMethod) error {
+	existingAuths, err := v.cl.Sys().ListAuth()
 
-func (v *vault) configurePolicies() error {
-	policies := []map[string]string{}
-	err := viper.UnmarshalKey("policies", &policies)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling vault policy config: %s", err.Error())
+		return fmt.Errorf("error listing auth backends vault: %s", err.Error())
 	}
 
-	for _, policy := range policies {
-		err := v.cl.Sys().PutPolicy(policy["name"], policy["rules"])
+	for _, authMethod := range authMethods {
+		authMethodType := authMethod.Type
+		path := authMethod.MountPath()
+
+		// Check and tune existing auth mounts
+		if authMount, ok := existingAuths[path+"/"]; ok && authMount.Type == authMethodType {
+			logrus.Debugf("%s auth backend is already mounted in vault", authMethodType)
 
+			warnImmutableMountSettings("sys/auth/"+path, authMethod.Local, authMount.Local, authMethod.SealWrap, authMount.SealWrap)
+
+			tuneConfig := mountTuneConfig(authMethod.Description, authMethod.MountTuning, nil)
+			if len(tuneConfig) > 0 {
+				err := v.writeConfig(fmt.Sprintf("sys/auth/%s/tune", path), tuneConfig)
+				if err != nil {
+					return fmt.Errorf("error tuning %s auth method in vault: %s", path, err.Error())
+				}
+			}
+		} else {
+			logrus.Debugf("enabling %s auth backend in vault...", authMethodType)
+
+			// https://www.vaultproject.io/api/system/auth.html
+			options := api.EnableAuthOptions{
+				Type:        authMethodType,
+				Description: authMethod.Description,
+				Local:       authMethod.Local,
+				SealWrap:    authMethod.SealWrap,
+				Config: api.AuthConfigInput{
+					DefaultLeaseTTL:           authMethod.DefaultLeaseTTL,
+					MaxLeaseTTL:               authMethod.MaxLeaseTTL,
+					ListingVisibility:         authMethod.ListingVisibility,
+					AuditNonHMACRequestKeys:   authMethod.AuditNonHMACRequestKeys,
+					PassthroughRequestHeaders: authMethod.PassthroughRequestHeaders,
+				},
+			}
+
+			err := v.enableAuth(path, &options)
+
+			if err != nil {
+				return fmt.Errorf("error enabling %s auth method for vault: %s", authMethodType, err.Error())
+			}
+		}
+
+		err = v.configureAuthMethod(path, authMethod)
 		if err != nil {
-			return fmt.Errorf("error putting %s policy into vault: %s", policy["name"], err.Error())
+			return fmt.Errorf("error configuring %s auth method for vault: %s", path, err.Error())
 		}
 	}
 
 	return nil
 }
 
-func (v *vault) configureKubernetesRoles(roles []interface{}) error {
-	for _, roleInterface := range roles {
-		role := cast.ToStringMap(roleInterface)
-		_, err := v.cl.Logical().Write(fmt.Sprint("auth/kubernetes/role/", role["name"]), role)
+// mountTuneConfig returns the tunable settings of an auth method or secret engine which are set in the config
+func mountTuneConfig(description string, tuning MountTuning, options map[string]interface{}) map[string]interface{} {
+	config := map[string]interface{}{}
+	if description != "" {
+		config["description"] = description
+	}
+	if tuning.DefaultLeaseTTL != "" {
+		config["default_lease_ttl"] = tuning.DefaultLeaseTTL
+	}
+	if tuning.MaxLeaseTTL != "" {
+		config["max_lease_ttl"] = tuning.MaxLeaseTTL
+	}
+	if tuning.ListingVisibility != "" {
+		config["listing_visibility"] = tuning.ListingVisibility
+	}
+	if len(tuning.AuditNonHMACRequestKeys) > 0 {
+		config["audit_non_hmac_request_keys"] = tuning.AuditNonHMACRequestKeys
+	}
+	if len(tuning.PassthroughRequestHeaders) > 0 {
+		config["passthrough_request_headers"] = tuning.PassthroughRequestHeaders
+	}
+	if len(options) > 0 {
+		config["options"] = cast.ToStringMapString(options)
+	}
+	return config
+}
+
+// warnImmutableMountSettings warns about the settings which can only be set when mounting
+func warnImmutableMountSettings(path string, local, existingLocal, sealWrap, existingSealWrap bool) {
+	if local != existingLocal {
+		logrus.Warnf("%s is mounted with local=%t, it can't be changed without remounting", path, existingLocal)
+	}
+	if sealWrap != existingSealWrap {
+		logrus.Warnf("%s is mounted with seal_wrap=%t, it can't be changed without remounting", path, existingSealWrap)
+	}
+}
+
+// authConfigPaths are the config paths of the auth methods not using auth/<path>/config
+var authConfigPaths = map[string]string{
+	"aws": "config/client",
+}
+
+// authRolePaths are the role paths of the auth methods not using auth/<path>/role/<name>
+var authRolePaths = map[string]string{
+	"cert": "certs",
+}
 
+// configureAuthMethod writes the config, the roles and the other sections of
+// an auth method under auth/<path>/
+func (v *vault) configureAuthMethod(path string, authMethod AuthMethod) error {
+	configPath := "config"
+	if p, ok := authConfigPaths[authMethod.Type]; ok {
+		configPath = p
+	}
+	rolePath := "role"
+	if p, ok := authRolePaths[authMethod.Type]; ok {
+		rolePath = p
+	}
+
+	config := authMethod.Config
+	if authMethod.Type == "kubernetes" {
+		var err error
+		config, err = kubernetesAuthConfig(config)
 		if err != nil {
-			return fmt.Errorf("error putting %s kubernetes role into vault: %s", role["name"], err.Error())
+			return fmt.Errorf("error building kubernetes auth config: %s", err.Error())
 		}
 	}
-	return nil
-}
 
-func (v *vault) configureGithubConfig(config map[string]interface{}) error {
-	// https://www.vaultproject.io/api/auth/github/index.html
-	_, err := v.cl.Logical().Write("auth/github/config", config)
+	if len(config) > 0 {
+		err := v.writeConfig(fmt.Sprintf("auth/%s/%s", path, configPath), config)
+		if err != nil {
+			return fmt.Errorf("error putting config into vault: %s", err.Error())
+		}
+	}
 
+	roles := authMethod.Roles
+	if authMethod.Type == "approle" {
+		roles = withoutAppRoleCredentials(roles)
+	}
+	err := v.configureAuthItems(path, rolePath, roles)
 	if err != nil {
-		return fmt.Errorf("error putting %s github config into vault: %s", config, err.Error())
+		return err
+	}
+
+	for _, section := range sortedKeys(authMethod.Sections) {
+		err := v.configureAuthItems(path, section, authMethod.Sections[section])
+		if err != nil {
+			return err
+		}
 	}
-	return nil
-}
 
-func (v *vault) configureGithubMappings(mappings map[string]interface{}) error {
-	for mappingType, mapping := range mappings {
-		for userOrTeam, policy := range cast.ToStringMapString(mapping) {
-			_, err := v.cl.Logical().Write(fmt.Sprintf("auth/github/map/%s/%s", mappingType, userOrTeam), map[string]interface{}{"value": policy})
+	// https://www.vaultproject.io/api/auth/github/index.html#map-github-teams
+	for mappingType, mapping := range authMethod.Map {
+		for userOrTeam, policy := range mapping {
+			err := v.writeConfig(fmt.Sprintf("auth/%s/map/%s/%s", path, mappingType, userOrTeam), map[string]interface{}{"value": policy})
 			if err != nil {
-				return fmt.Errorf("error putting %s github mapping into vault: %s", mappingType, err.Error())
+				return fmt.Errorf("error putting %s %s mapping into vault: %s", mappingType, userOrTeam, err.Error())
 			}
 		}
 	}
+
+	if authMethod.Type == "approle" {
+		return v.deliverAppRoleCredentials(path, authMethod.Roles)
+	}
+
 	return nil
 }
 
-func (v *vault) configureAwsConfig(config map[string]interface{}) error {
-	// https://www.vaultproject.io/api/auth/aws/index.html
-	_, err := v.cl.Logical().Write("auth/aws/config/client", config)
+// configureAuthItems writes the named items of a section to auth/<path>/<section>/<name>
+func (v *vault) configureAuthItems(path, section string, items []map[string]interface{}) error {
+	for _, item := range items {
+		err := v.writeConfig(fmt.Sprintf("auth/%s/%s/%s", path, section, item["name"]), item)
 
-	if err != nil {
-		return fmt.Errorf("error putting %s aws config into vault: %s", config, err.Error())
+		if err != nil {
+			return fmt.Errorf("error putting %s %s into vault: %s", item["name"], section, err.Error())
+		}
 	}
 	return nil
 }
 
-func (v *vault) configureAwsRoles(roles []interface{}) error {
-	for _, roleInterface := range roles {
-		role := cast.ToStringMap(roleInterface)
-		_, err := v.cl.Logical().Write(fmt.Sprint("auth/aws/role/", role["name"]), role)
+func (v *vault) configurePolicies(policies []Policy) error {
+	for _, policy := range policies {
+		err := v.putPolicy(policy.Name, policy.Rules)
 
 		if err != nil {
-			return fmt.Errorf("error putting %s aws role into vault: %s", role["name"], err.Error())
+			return fmt.Errorf("error putting %s policy into vault: %s", policy.Name, err.Error())
 		}
 	}
+
 	return nil
 }
 
-func (v *vault) configureSecretEngines() error {
-	secretsEngines := []map[string]interface{}{}
-	err := viper.UnmarshalKey("secrets", &secretsEngines)
-	if err != nil {
-		return fmt.Errorf("error unmarshalling vault secrets config: %s", err.Error())
-	}
+func (v *vault) configureSecretEngines(secretsEngines []SecretEngine) error {
+	// skipped lists the configuration which wasn't written, with the reason
+	skipped := []string{}
+	defer func() {
+		if len(skipped) > 0 {
+			logrus.Warnf("skipped secret engine configuration: %s", strings.Join(skipped, ", "))
+		}
+	}()
 
 	for _, secretEngine := range secretsEngines {
-		secretEngineType := secretEngine["type"].(string)
-
-		path := secretEngineType
-		if pathOverwrite, ok := secretEngine["path"]; ok {
-			path = pathOverwrite.(string)
-		}
+		secretEngineType := secretEngine.Type
+		path := secretEngine.MountPath()
 
 		mounts, err := v.cl.Sys().ListMounts()
 		if err != nil {
 			return fmt.Errorf("error reading mounts from vault: %s", err.Error())
 		}
-		fmt.Printf("Already existing mounts: %#v\n", mounts)
+		logrus.Debugf("already existing mounts: %#v", mounts)
+
+		// the secret engine is moved with its data and leases, if it is only mounted to its previous path
+		previousPath := strings.Trim(secretEngine.PreviousPath, "/")
+		if previousPath != "" && mounts[previousPath+"/"] != nil {
+			if mounts[path+"/"] == nil {
+				logrus.Infof("moving %s secret engine to %s", previousPath, path)
+				err = v.remount(previousPath, path)
+				if err != nil {
+					return fmt.Errorf("error moving %s secret engine to %s: %s", previousPath, path, err.Error())
+				}
+				mounts[path+"/"] = mounts[previousPath+"/"]
+			} else {
+				logrus.Warnf("%s secret engine isn't moved to %s, since both of them are mounted", previousPath, path)
+			}
+		}
+
 		if mounts[path+"/"] == nil {
 			input := api.MountInput{
 				Type:        secretEngineType,
-				Description: getOrDefault(secretEngine, "description"),
-				PluginName:  getOrDefault(secretEngine, "plugin_name"),
-				Options:     getOrDefaultStringMapString(secretEngine, "options"),
+				Description: secretEngine.Description,
+				PluginName:  secretEngine.PluginName,
+				Options:     cast.ToStringMapString(secretEngine.Options),
+				Local:       secretEngine.Local,
+				SealWrap:    secretEngine.SealWrap,
+				Config: api.MountConfigInput{
+					DefaultLeaseTTL:           secretEngine.DefaultLeaseTTL,
+					MaxLeaseTTL:               secretEngine.MaxLeaseTTL,
+					ListingVisibility:         secretEngine.ListingVisibility,
+					AuditNonHMACRequestKeys:   secretEngine.AuditNonHMACRequestKeys,
+					PassthroughRequestHeaders: secretEngine.PassthroughRequestHeaders,
+				},
 			}
-			logrus.Infoln("Mounting secret engine with input: %#v\n", input)
-			err = v.cl.Sys().Mount(path, &input)
+			logrus.Infof("Mounting secret engine with input: %#v", input)
+			err = v.mount(path, &input)
 			if err != nil {
 				return fmt.Errorf("error mounting %s into vault: %s", path, err.Error())
 			}
@@ -496,62 +918,74 @@ func (v *vault) configureSecretEngines() error {
 			logrus.Infoln("mounted", secretEngineType, "to", path)
 
 		} else {
-			input := api.MountConfigInput{
-				Options: getOrDefaultStringMapString(secretEngine, "options"),
+			mount := mounts[path+"/"]
+			warnImmutableMountSettings("sys/mounts/"+path, secretEngine.Local, mount.Local, secretEngine.SealWrap, mount.SealWrap)
+
+			tuneConfig := mountTuneConfig(secretEngine.Description, secretEngine.MountTuning, secretEngine.Options)
+			if len(tuneConfig) > 0 {
+				err = v.writeConfig(fmt.Sprintf("sys/mounts/%s/tune", path), tuneConfig)
+				if err != nil {
+					return fmt.Errorf("error tuning %s in vault: %s", path, err.Error())
+				}
 			}
-			err = v.cl.Sys().TuneMount(path, input)
+		}
+
+		if secretEngine.PKI != nil {
+			err = v.configurePKI(path, secretEngine.PKI)
 			if err != nil {
-				return fmt.Errorf("error tuning %s in vault: %s", path, err.Error())
+				return fmt.Errorf("error configuring %s pki secret engine: %s", path, err.Error())
 			}
 		}
 
 		// Configuration of the Secret Engine in a very generic manner, YAML config file should have the proper format
-		configuration := getOrDefaultStringMap(secretEngine, "configuration")
-		for configOption, configData := range configuration {
-			configData := configData.([]interface{})
+		for configOption, configData := range secretEngine.Configuration {
 			for _, subConfigData := range configData {
-				subConfigData := subConfigData.(map[interface{}]interface{})
 				configPath := fmt.Sprintf("%s/%s/%s", path, configOption, subConfigData["name"])
-				_, err := v.cl.Logical().Write(configPath, cast.ToStringMap(subConfigData))
+
+				rotatePath := rotateRootPath(secretEngine, fmt.Sprintf("%s/%s", configOption, subConfigData["name"]))
+				if rotatePath != "" {
+					rotated, err := v.rootRotated(configPath, subConfigData)
+					if err != nil {
+						return err
+					}
+					if rotated {
+						logrus.Debugf("the root credentials of %s are rotated, it isn't written again", configPath)
+						continue
+					}
+				}
+
+				err := v.writeConfig(configPath, subConfigData)
 
 				if err != nil {
 					if isOverwriteProbihitedError(err) {
-						logrus.Debugln("Can't reconfigure", configPath, "please delete it manually")
+						skipped = append(skipped, configPath+" (it can't be overwritten, use paths with replace mode)")
 						continue
 					}
 					return fmt.Errorf("error putting %+v -> %s config into vault: %s", configData, configPath, err.Error())
 				}
+
+				if rotatePath != "" {
+					err = v.rotateRoot(configPath, rotatePath, subConfigData)
+					if err != nil {
+						return err
+					}
+				}
 			}
 		}
-	}
 
-	return nil
-}
-
-func getOrDefault(m map[string]interface{}, key string) string {
-	value := m[key]
-	if value != nil {
-		return value.(string)
+		skippedPaths, err := v.configureSecretEnginePaths(secretEngine)
+		skipped = append(skipped, skippedPaths...)
+		if err != nil {
+			return err
+		}
 	}
-	return ""
-}
 
-func getOrDefaultStringMapString(m map[string]interface{}, key string) map[string]string {
-	value := m[key]
-	stringMap := map[string]string{}
-	if value != nil {
-		return cast.ToStringMapString(value)
-	}
-	return stringMap
+	return nil
 }
 
-func getOrDefaultStringMap(m map[string]interface{}, key string) map[string]interface{} {
-	value := m[key]
-	stringMap := map[string]interface{}{}
-	if value != nil {
-		return cast.ToStringMap(value)
-	}
-	return stringMap
+// isKeyRejectedError checks if vault refused an unseal key with a Bad Request
+func isKeyRejectedError(err error) bool {
+	return strings.Contains(err.Error(), "Code: 400")
 }
 
 func isOverwriteProbihitedError(err error) bool {
@@ -0,0 +1,220 @@
+package vault
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jacohend/bank-vaults/pkg/kv"
+)
+
+func TestCombinations(t *testing.T) {
+	tests := []struct {
+		n, k     int
+		expected [][]int
+	}{
+		{3, 2, [][]int{{0, 1}, {0, 2}, {1, 2}}},
+		{3, 3, [][]int{{0, 1, 2}}},
+		{4, 1, [][]int{{0}, {1}, {2}, {3}}},
+		{2, 3, [][]int{}},
+		{2, 0, [][]int{}},
+	}
+
+	for _, test := range tests {
+		actual := [][]int{}
+		combinations(test.n, test.k, func(subset []int) bool {
+			actual = append(actual, subset)
+			return true
+		})
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("combinations(%d, %d) = %v, expected %v", test.n, test.k, actual, test.expected)
+		}
+	}
+
+	count := 0
+	combinations(30, 15, func(subset []int) bool {
+		count++
+		return count < 3
+	})
+	if count != 3 {
+		t.Errorf("expected the generation to stop after 3 combinations, got %d", count)
+	}
+}
+
+// fakeUnseal handles the unseal endpoints of the fake Vault with the threshold and the valid keys,
+// keys starting with invalid are rejected with a Bad Request, other unknown keys count as progress
+// but reset it once the threshold is reached
+func fakeUnseal(f *fakeVault, threshold, shares int, valid ...string) (resets *int) {
+	sealed := true
+	pending := []string{}
+	resets = new(int)
+
+	status := func() (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"sealed": sealed, "t": threshold, "n": shares, "progress": len(pending)}
+	}
+	f.handle("GET", "sys/seal-status", func(map[string]interface{}) (int, interface{}) { return status() })
+	f.handle("PUT", "sys/unseal", func(body map[string]interface{}) (int, interface{}) {
+		if body["reset"] == true {
+			*resets++
+			pending = []string{}
+			return status()
+		}
+		key := body["key"].(string)
+		if strings.HasPrefix(key, "invalid") {
+			return http.StatusBadRequest, map[string]interface{}{"errors": []string{"invalid key"}}
+		}
+		pending = append(pending, key)
+		if len(pending) < threshold {
+			return status()
+		}
+		sealed = false
+		for _, key := range pending {
+			if !contains(valid, key) {
+				sealed = true
+			}
+		}
+		pending = []string{}
+		return status()
+	})
+	return resets
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUnsealSkipsUnusableKeys(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	resets := fakeUnseal(f, 2, 5, "key3", "key4")
+
+	store := newMemoryKV()
+	// vault-unseal-0 is missing
+	store.Set("vault-unseal-1", []byte("invalid1"))
+	store.Set("vault-unseal-2", []byte("corrupt2"))
+	store.Set("vault-unseal-3", []byte("key3"))
+	store.Set("vault-unseal-4", []byte("key4"))
+
+	err := f.vault(store).Unseal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// after the rejected key1 and the subsets of the corrupt key2 with key3 and key4
+	if *resets != 3 {
+		t.Errorf("expected 3 resets of the unseal progress, got %d", *resets)
+	}
+	if string(store.data["vault-unseal-3"]) != "key3" {
+		t.Error("expected the key store to be left intact")
+	}
+}
+
+func TestUnsealFails(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	fakeUnseal(f, 2, 3, "key2")
+
+	store := newMemoryKV()
+	store.Set("vault-unseal-1", []byte("corrupt1"))
+	store.Set("vault-unseal-2", []byte("key2"))
+
+	err := f.vault(store).Unseal()
+	if err == nil {
+		t.Fatal("expected vault to stay sealed")
+	}
+	for _, expected := range []string{"'vault-unseal-0' (key 'vault-unseal-0' is not present)", "'vault-unseal-1' (possibly corrupt)"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %s", expected, err.Error())
+		}
+	}
+}
+
+func TestUnsealResetsProgress(t *testing.T) {
+	f := newFakeVault(t)
+	defer f.Close()
+	resets := fakeUnseal(f, 2, 2, "key0", "key1")
+
+	// a previous attempt left a key behind
+	f.client().Sys().Unseal("corrupt")
+	store := newMemoryKV()
+	store.Set("vault-unseal-0", []byte("key0"))
+	store.Set("vault-unseal-1", []byte("key1"))
+
+	err := f.vault(store).Unseal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *resets != 1 {
+		t.Errorf("expected the progress to be reset before unsealing, got %d resets", *resets)
+	}
+}
+
+// memoryKV is an in-memory kv.Service, which rejects empty values like the AWS KMS key store
+type memoryKV struct {
+	data map[string][]byte
+}
+
+func newMemoryKV() *memoryKV {
+	return &memoryKV{data: map[string][]byte{}}
+}
+
+func (m *memoryKV) Set(key string, value []byte) error {
+	if len(value) == 0 {
+		return errors.New("empty value")
+	}
+	m.data[key] = value
+	return nil
+}
+
+func (m *memoryKV) Get(key string) ([]byte, error) {
+	value, ok := m.data[key]
+	if !ok {
+		return nil, kv.NewNotFoundError("key '%s' is not present", key)
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (m *memoryKV) Test(key string) error {
+	return nil
+}
+
+// discardKV stores nothing, like the dev key store
+type discardKV struct{}
+
+func (discardKV) Set(key string, value []byte) error { return nil }
+func (discardKV) Get(key string) ([]byte, error) {
+	return nil, kv.NewNotFoundError("key '%s' is not present", key)
+}
+func (discardKV) Test(key string) error { return nil }
+
+func TestSealLock(t *testing.T) {
+	store := newMemoryKV()
+
+	if lock, err := SealLock(store); err != nil || lock != "" {
+		t.Fatalf("expected no seal lock, got %q, %v", lock, err)
+	}
+
+	if err := LockSeal(store, "maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	if lock, err := SealLock(store); err != nil || !strings.HasSuffix(lock, ": maintenance") {
+		t.Fatalf("expected the seal lock, got %q, %v", lock, err)
+	}
+
+	if err := ClearSealLock(store); err != nil {
+		t.Fatal(err)
+	}
+	if lock, err := SealLock(store); err != nil || lock != "" {
+		t.Fatalf("expected the seal lock to be cleared, got %q, %v", lock, err)
+	}
+
+	if err := LockSeal(discardKV{}, "maintenance"); err == nil {
+		t.Error("expected an error from a key store which doesn't keep the seal lock")
+	}
+}